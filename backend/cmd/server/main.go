@@ -100,10 +100,31 @@ func main() {
 	router.POST("api/v1/settings", middleware.AuthMiddleware(), handlers.UpdateSettingsHandler(dbService, settingsService))
 	router.DELETE("api/v1/settings/:service", middleware.AuthMiddleware(), handlers.DeleteSettingsHandler(dbService, settingsService))
 	router.GET("api/v1/providers", handlers.GetSupportedProvidersHandler())
+	router.GET("api/v1/providers/local/models", middleware.AdminMiddleware(dbService), handlers.GetLocalModelsHandler(aiService))
 	router.GET("api/v1/profile", middleware.AuthMiddleware(), handlers.ProfileHandler(dbService))
-	router.POST("api/v1/query", handlers.QueryHandler(aiService, dbService, settingsService))
-	router.POST("api/v1/analyze", handlers.AnalyzeHandler(aiService, dbService, settingsService))
-	router.POST("api/v1/feedback", handlers.FeedbackHandler(dbService))
+	router.POST("api/v1/profile/api-token", middleware.AuthMiddleware(), handlers.CreateAPITokenHandler(dbService))
+	router.DELETE("api/v1/profile/api-token", middleware.AuthMiddleware(), handlers.RevokeAPITokenHandler(dbService))
+
+	// AI routes attribute requests to the caller when a token is sent; REQUIRE_AUTH_FOR_AI rejects anonymous callers
+	identifyUser := middleware.IdentifyUserMiddleware(dbService, os.Getenv("REQUIRE_AUTH_FOR_AI") == "true")
+	router.POST("api/v1/query", identifyUser, handlers.QueryHandler(aiService, dbService, settingsService))
+	router.POST("api/v1/query/stream", identifyUser, handlers.QueryStreamHandler(aiService, dbService, settingsService))
+	router.POST("api/v1/analyze", identifyUser, handlers.AnalyzeHandler(aiService, dbService, settingsService))
+	router.POST("api/v1/feedback", identifyUser, handlers.FeedbackHandler(dbService))
+
+	// History routes always need a user, whatever the AI auth policy
+	requireUser := middleware.IdentifyUserMiddleware(dbService, true)
+	// Stored threads belong to a signed-in user; anonymous callers pass their turns in the query context instead
+	router.POST("api/v1/conversations", requireUser, handlers.CreateConversationHandler(dbService))
+	router.GET("api/v1/conversations", requireUser, handlers.ListConversationsHandler(dbService))
+	router.GET("api/v1/conversations/:id", requireUser, handlers.GetConversationHandler(dbService))
+	router.PATCH("api/v1/conversations/:id", requireUser, handlers.RenameConversationHandler(dbService))
+	router.DELETE("api/v1/conversations/:id", requireUser, handlers.DeleteConversationHandler(dbService))
+	router.GET("api/v1/history", requireUser, handlers.ListHistoryHandler(dbService))
+	router.GET("api/v1/history/search", requireUser, handlers.SearchHistoryHandler(dbService))
+	router.GET("api/v1/history/export", requireUser, handlers.ExportHistoryHandler(dbService))
+	router.GET("api/v1/history/:id", requireUser, handlers.GetHistoryItemHandler(dbService))
+
 	router.POST("api/v1/login", handlers.LoginHandler(dbService))
 	router.POST("api/v1/register", handlers.RegisterHandler(dbService))
 
@@ -111,6 +132,11 @@ func main() {
 	router.GET("api/v1/admin/users", middleware.AdminMiddleware(dbService), handlers.GetAllUsersHandler(dbService))
 	router.PUT("api/v1/admin/users/:id/role", middleware.AdminMiddleware(dbService), handlers.UpdateUserRoleHandler(dbService))
 	router.DELETE("api/v1/admin/users/:id", middleware.AdminMiddleware(dbService), handlers.DeleteUserHandler(dbService))
+	router.GET("api/v1/admin/usage", middleware.AdminMiddleware(dbService), handlers.GetUsageStatsHandler(dbService))
+	router.GET("api/v1/admin/feedback/stats", middleware.AdminMiddleware(dbService), handlers.GetFeedbackStatsHandler(dbService))
+	router.GET("api/v1/admin/feedback/worst", middleware.AdminMiddleware(dbService), handlers.GetWorstRatedAnswersHandler(dbService))
+	router.DELETE("api/v1/admin/cache", middleware.AdminMiddleware(dbService), handlers.PurgeCacheHandler(aiService))
+	router.GET("api/v1/admin/providers/health", middleware.AdminMiddleware(dbService), handlers.GetProviderHealthHandler(aiService))
 
 	// Social auth routes
 	/*
@@ -56,7 +56,7 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid request format or level",
+                        "description": "Invalid request format, level or language",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -72,46 +72,41 @@ const docTemplate = `{
                                 "type": "string"
                             }
                         }
+                    },
+                    "504": {
+                        "description": "AI provider timed out",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
             }
         },
-        "/api/v1/feedback": {
-            "post": {
-                "description": "Submit feedback for an AI interaction",
-                "consumes": [
-                    "application/json"
-                ],
+        "/api/v1/conversations": {
+            "get": {
+                "description": "List the caller's conversation threads, most recently active first",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Feedback"
-                ],
-                "summary": "Submit feedback",
-                "parameters": [
-                    {
-                        "description": "Feedback details",
-                        "name": "feedback",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handlers.FeedbackRequest"
-                        }
-                    }
+                    "Conversations"
                 ],
+                "summary": "List conversations",
                 "responses": {
                     "200": {
-                        "description": "Feedback submitted successfully",
+                        "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handlers.ConversationResponse"
                             }
                         }
                     },
-                    "400": {
-                        "description": "Invalid request format",
+                    "401": {
+                        "description": "Not signed in",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -119,8 +114,8 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "404": {
-                        "description": "Query ID not found",
+                    "500": {
+                        "description": "Internal server error",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -129,11 +124,9 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/api/v1/query": {
+            },
             "post": {
-                "description": "Send a query to the AI and get a response",
+                "description": "Start a new conversation thread; pass its ID as conversation_id to /query to continue it. Requires signing in.",
                 "consumes": [
                     "application/json"
                 ],
@@ -141,25 +134,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "AI Interaction"
+                    "Conversations"
                 ],
-                "summary": "Query the AI",
+                "summary": "Create a conversation",
                 "parameters": [
                     {
-                        "description": "Query parameters",
-                        "name": "query",
+                        "description": "Optional title",
+                        "name": "conversation",
                         "in": "body",
-                        "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handlers.QueryRequest"
+                            "$ref": "#/definitions/handlers.ConversationRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/handlers.QueryResponse"
+                            "$ref": "#/definitions/handlers.ConversationResponse"
                         }
                     },
                     "400": {
@@ -171,6 +163,15 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "401": {
+                        "description": "Not signed in",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -183,40 +184,34 @@ const docTemplate = `{
                 }
             }
         },
-        "/login": {
-            "post": {
-                "description": "Authenticate user and return JWT token",
-                "consumes": [
-                    "application/json"
-                ],
+        "/api/v1/conversations/{id}": {
+            "get": {
+                "description": "Get a conversation thread with all of its queries and answers",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "authentication"
+                    "Conversations"
                 ],
-                "summary": "User login",
+                "summary": "Get a conversation",
                 "parameters": [
                     {
-                        "description": "Login credentials",
-                        "name": "credentials",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handlers.LoginRequest"
-                        }
+                        "type": "string",
+                        "description": "Conversation ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Example: {'token': 'eyJhbG...', 'user': {'username': 'johndoe', 'role': 'user'}}",
+                        "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/handlers.ConversationDetailResponse"
                         }
                     },
                     "400": {
-                        "description": "Example: {'error': 'Invalid request format'}",
+                        "description": "Invalid conversation ID",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -225,7 +220,16 @@ const docTemplate = `{
                         }
                     },
                     "401": {
-                        "description": "Example: {'error': 'Invalid credentials'}",
+                        "description": "Not signed in",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Conversation not found",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -234,7 +238,7 @@ const docTemplate = `{
                         }
                     },
                     "500": {
-                        "description": "Example: {'error': 'Failed to generate token'}",
+                        "description": "Internal server error",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -243,32 +247,46 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/profile": {
-            "get": {
-                "security": [
-                    {
-                        "ApiKeyAuth": []
-                    }
-                ],
-                "description": "Get the authenticated user's profile information",
+            },
+            "delete": {
+                "description": "Delete a conversation thread together with its queries",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "authentication"
+                    "Conversations"
+                ],
+                "summary": "Delete a conversation",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Conversation ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Get user profile",
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Conversation deleted",
                         "schema": {
-                            "$ref": "#/definitions/handlers.ProfileResponse"
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid conversation ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     },
                     "401": {
-                        "description": "Example: {'error': 'Unauthorized'}",
+                        "description": "Not signed in",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -276,44 +294,28 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "500": {
-                        "description": "Example: {'error': 'Internal server error'}",
+                    "404": {
+                        "description": "Conversation not found",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
                                 "type": "string"
                             }
                         }
-                    }
-                }
-            }
-        },
-        "/providers": {
-            "get": {
-                "description": "Return the list of supported AI providers with their default configurations",
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "settings"
-                ],
-                "summary": "Get supported AI providers",
-                "responses": {
-                    "200": {
-                        "description": "OK",
+                    },
+                    "500": {
+                        "description": "Internal server error",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/handlers.ProviderConfigResponse"
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
                             }
                         }
                     }
                 }
-            }
-        },
-        "/register": {
-            "post": {
-                "description": "Register a new user with their details",
+            },
+            "patch": {
+                "description": "Change the title of a conversation thread",
                 "consumes": [
                     "application/json"
                 ],
@@ -321,23 +323,30 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "authentication"
+                    "Conversations"
                 ],
-                "summary": "User registration",
+                "summary": "Rename a conversation",
                 "parameters": [
                     {
-                        "description": "Registration details",
-                        "name": "registration",
+                        "type": "string",
+                        "description": "Conversation ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New title",
+                        "name": "conversation",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handlers.RegisterRequest"
+                            "$ref": "#/definitions/handlers.ConversationRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Example: {'message': 'User registered successfully'}",
+                    "200": {
+                        "description": "Conversation renamed",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -346,7 +355,7 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Example: {'error': 'Invalid request format'} or {'error': 'Email already registered'} or {'error': 'Password must contain...'}",
+                        "description": "Invalid request format",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -354,40 +363,26 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "500": {
-                        "description": "Example: {'error': 'Internal server error'} or {'error': 'Failed to create user'}",
+                    "401": {
+                        "description": "Not signed in",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
                                 "type": "string"
                             }
                         }
-                    }
-                }
-            }
-        },
-        "/settings": {
-            "get": {
-                "description": "Return for each service: provider, model, encrypted_api_key, and prompts",
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "settings"
-                ],
-                "summary": "Get AI settings",
-                "responses": {
-                    "200": {
-                        "description": "OK",
+                    },
+                    "404": {
+                        "description": "Conversation not found",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
-                                "$ref": "#/definitions/handlers.AiSettingsResponse"
+                                "type": "string"
                             }
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "Internal server error",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -396,9 +391,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
+            }
+        },
+        "/api/v1/feedback": {
             "post": {
-                "description": "Accepts raw api_key; server will encrypt it and store under encrypted_api_key",
+                "description": "Submit a vote, 1-5 rating, comment and reason tags for an AI answer or a single analysis suggestion.\nSigned-in users update their earlier feedback on the same answer or suggestion.",
                 "consumes": [
                     "application/json"
                 ],
@@ -406,23 +403,30 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "settings"
+                    "Feedback"
                 ],
-                "summary": "Update AI settings",
+                "summary": "Submit feedback",
                 "parameters": [
                     {
-                        "description": "Service configuration update request",
-                        "name": "request",
+                        "description": "Feedback details",
+                        "name": "feedback",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handlers.ServiceConfig"
+                            "$ref": "#/definitions/handlers.FeedbackRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "status: success",
+                        "description": "Feedback submitted successfully",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request format",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -430,8 +434,8 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "400": {
-                        "description": "Invalid request format or missing api_key",
+                    "404": {
+                        "description": "Query or suggestion not found",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -440,7 +444,7 @@ const docTemplate = `{
                         }
                     },
                     "500": {
-                        "description": "Server error encrypting or saving",
+                        "description": "Internal server error",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -451,25 +455,974 @@ const docTemplate = `{
                 }
             }
         },
-        "/settings/{service}": {
-            "delete": {
-                "description": "Delete the AI settings for a specific service",
-                "consumes": [
-                    "application/json"
+        "/api/v1/history": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
                 ],
+                "description": "List the authenticated user's past queries and analyses, newest first, with cursor pagination",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "settings"
+                    "History"
                 ],
-                "summary": "Delete AI settings",
+                "summary": "List query history",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Service name",
+                        "description": "Cursor returned as next_cursor by the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 20, max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by service, e.g. query or analyze",
                         "name": "service",
-                        "in": "path",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "novice",
+                            "medium",
+                            "expert"
+                        ],
+                        "type": "string",
+                        "description": "Filter by level",
+                        "name": "level",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by AI provider",
+                        "name": "provider",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "positive",
+                            "negative",
+                            "neutral",
+                            "none"
+                        ],
+                        "type": "string",
+                        "description": "Filter by feedback; none selects queries without feedback",
+                        "name": "feedback",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only queries at or after this time (RFC 3339 or YYYY-MM-DD)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only queries before this time (RFC 3339, or YYYY-MM-DD for the whole day)",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HistoryResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid filter or cursor",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Authentication required",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/history/export": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Download one query, one conversation thread or a date range of the caller's history as Markdown, JSON or standalone HTML.\nPass exactly one of id or conversation_id, or neither to export by date range. Admins may export any query or thread,\nand another user's date range with user_id.",
+                "produces": [
+                    "text/markdown",
+                    "application/json",
+                    "text/html"
+                ],
+                "tags": [
+                    "History"
+                ],
+                "summary": "Export history",
+                "parameters": [
+                    {
+                        "enum": [
+                            "markdown",
+                            "json",
+                            "html"
+                        ],
+                        "type": "string",
+                        "description": "Output format (default markdown)",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Export a single query",
+                        "name": "id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Export a conversation thread",
+                        "name": "conversation_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only queries at or after this time (RFC 3339 or YYYY-MM-DD)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only queries before this time (RFC 3339, or YYYY-MM-DD for the whole day)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Export another user's history (admins only)",
+                        "name": "user_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Export streamed as an attachment",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid parameters",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Authentication required",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Admin access required",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Query or conversation not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/history/search": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Full-text search over the authenticated user's past questions and answers, best match first.\nSupports web-search syntax (\"quoted phrases\", or, -excluded). Admins can pass all=true to search every user's history.\nSnippets are HTML-escaped, with matches wrapped in \u003cmark\u003e\u003c/mark\u003e.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "History"
+                ],
+                "summary": "Search query history",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search terms",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by service, e.g. query or analyze",
+                        "name": "service",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Search all users (admins only)",
+                        "name": "all",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 20, max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of results to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SearchResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing search terms or invalid parameters",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Authentication required",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Admin access required",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/history/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Get one of the authenticated user's past queries or analyses; admins may read any",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "History"
+                ],
+                "summary": "Get a past query",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Query ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HistoryItem"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid query ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Authentication required",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Query not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/query": {
+            "post": {
+                "description": "Send a query to the AI and get a response",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "AI Interaction"
+                ],
+                "summary": "Query the AI",
+                "parameters": [
+                    {
+                        "description": "Query parameters",
+                        "name": "query",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.QueryRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.QueryResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request format",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Conversation not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "504": {
+                        "description": "AI provider timed out",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/query/stream": {
+            "post": {
+                "description": "Send a query to the AI and receive the response as Server-Sent Events.\nEmits \"delta\" events with partial content, then a final \"done\" event with the query ID and full response, or an \"error\" event.\nFailures before the first delta are answered with a JSON error and status code instead of a stream.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "AI Interaction"
+                ],
+                "summary": "Query the AI with a streamed response",
+                "parameters": [
+                    {
+                        "description": "Query parameters",
+                        "name": "query",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.QueryRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "SSE stream of delta/done/error events",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request format",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Conversation not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "AI provider temporarily unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "504": {
+                        "description": "AI provider timed out",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/login": {
+            "post": {
+                "description": "Authenticate user and return JWT token",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "authentication"
+                ],
+                "summary": "User login",
+                "parameters": [
+                    {
+                        "description": "Login credentials",
+                        "name": "credentials",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.LoginRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Example: {'token': 'eyJhbG...', 'user': {'username': 'johndoe', 'role': 'user'}}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Example: {'error': 'Invalid request format'}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Example: {'error': 'Invalid credentials'}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Example: {'error': 'Failed to generate token'}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/profile": {
+            "get": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Get the authenticated user's profile information",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "authentication"
+                ],
+                "summary": "Get user profile",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ProfileResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Example: {'error': 'Unauthorized'}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Example: {'error': 'Internal server error'}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/profile/api-token": {
+            "post": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Create a personal API token for the IDE extension, replacing any previous token. The token is only shown once.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "authentication"
+                ],
+                "summary": "Issue a personal API token",
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.APITokenResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Example: {'error': 'Unauthorized'}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Example: {'error': 'Failed to create API token'}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Revoke the authenticated user's personal API token",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "authentication"
+                ],
+                "summary": "Revoke the personal API token",
+                "responses": {
+                    "200": {
+                        "description": "Example: {'message': 'API token revoked'}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Example: {'error': 'Unauthorized'}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Example: {'error': 'Failed to revoke API token'}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/providers": {
+            "get": {
+                "description": "Return the list of supported AI providers with their default configurations",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "settings"
+                ],
+                "summary": "Get supported AI providers",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handlers.ProviderConfigResponse"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/providers/local/models": {
+            "get": {
+                "description": "Return the models exposed via /v1/models by the local OpenAI-compatible server (Ollama, llama.cpp) configured for a service",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "settings"
+                ],
+                "summary": "List local models",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Service whose local provider is queried, e.g. query",
+                        "name": "service",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "models: list of model IDs",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "array",
+                                "items": {
+                                    "type": "string"
+                                }
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Missing service or no local provider configured",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "502": {
+                        "description": "Local server unreachable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/register": {
+            "post": {
+                "description": "Register a new user with their details",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "authentication"
+                ],
+                "summary": "User registration",
+                "parameters": [
+                    {
+                        "description": "Registration details",
+                        "name": "registration",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.RegisterRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Example: {'message': 'User registered successfully'}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Example: {'error': 'Invalid request format'} or {'error': 'Email already registered'} or {'error': 'Password must contain...'}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Example: {'error': 'Internal server error'} or {'error': 'Failed to create user'}",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/settings": {
+            "get": {
+                "description": "Return for each service: provider, model, encrypted_api_key, and prompts",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "settings"
+                ],
+                "summary": "Get AI settings",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "$ref": "#/definitions/handlers.AiSettingsResponse"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Accepts raw api_key; server will encrypt it and store under encrypted_api_key",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "settings"
+                ],
+                "summary": "Update AI settings",
+                "parameters": [
+                    {
+                        "description": "Service configuration update request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ServiceConfig"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "status: success",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request format, missing api_key or incomplete provider or fallback settings",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Server error encrypting or saving",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/settings/{service}": {
+            "delete": {
+                "description": "Delete the AI settings for a specific service",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "settings"
+                ],
+                "summary": "Delete AI settings",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Service name",
+                        "name": "service",
+                        "in": "path",
                         "required": true
                     }
                 ],
@@ -544,6 +1497,15 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "handlers.APITokenResponse": {
+            "type": "object",
+            "properties": {
+                "token": {
+                    "type": "string",
+                    "example": "act_3f7a..."
+                }
+            }
+        },
         "handlers.AiSettingsResponse": {
             "description": "AI settings configuration for a service",
             "type": "object",
@@ -557,88 +1519,338 @@ const docTemplate = `{
                     "example": "groq"
                 },
                 "api_url": {
-                    "type": "string",
-                    "example": "https://api.groq.com/openai/v1/chat/completions"
+                    "type": "string",
+                    "example": "https://api.groq.com/openai/v1/chat/completions"
+                },
+                "api_version": {
+                    "type": "string",
+                    "example": "2024-02-01"
+                },
+                "deployment": {
+                    "type": "string",
+                    "example": "gpt-4o-tutor"
+                },
+                "encrypted_api_key": {
+                    "type": "string",
+                    "example": "encrypted_key_data"
+                },
+                "endpoint": {
+                    "type": "string",
+                    "example": "my-university"
+                },
+                "prompts": {
+                    "type": "object"
+                },
+                "temperature": {
+                    "type": "number",
+                    "example": 0.7
+                }
+            }
+        },
+        "handlers.AnalyzeRequest": {
+            "description": "Request structure for code analysis",
+            "type": "object",
+            "required": [
+                "code",
+                "level"
+            ],
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "def hello_world():\n    print('Hello, World!')"
+                },
+                "context": {
+                    "description": "Editor context sent by the IDE plugin, whose language and fileName are used when the fields above are empty"
+                },
+                "filename": {
+                    "type": "string",
+                    "example": "hello.py"
+                },
+                "includeLineNumbers": {
+                    "description": "Guess positions from the text when the AI reply has no usable line numbers",
+                    "type": "boolean",
+                    "example": true
+                },
+                "language": {
+                    "description": "Language ID as used by VS Code; taken from the editor context or detected from the filename and code when omitted",
+                    "type": "string",
+                    "example": "python"
+                },
+                "level": {
+                    "type": "string",
+                    "enum": [
+                        "beginner",
+                        "intermediate",
+                        "advanced"
+                    ],
+                    "example": "beginner"
+                },
+                "minSeverity": {
+                    "description": "Only return suggestions of this severity or worse; all suggestions are still stored",
+                    "type": "string",
+                    "enum": [
+                        "error",
+                        "warning",
+                        "info",
+                        "hint"
+                    ],
+                    "example": "warning"
+                }
+            }
+        },
+        "handlers.AnalyzeResponse": {
+            "description": "Response structure for code analysis results",
+            "type": "object",
+            "properties": {
+                "cached": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "language": {
+                    "description": "Given or detected language of the code",
+                    "type": "string",
+                    "example": "python"
+                },
+                "suggestions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.Suggestion"
+                    }
+                }
+            }
+        },
+        "handlers.ConversationDetailResponse": {
+            "description": "Conversation thread with its queries, oldest first",
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "messages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.ConversationMessage"
+                    }
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Python file handling"
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.ConversationMessage": {
+            "description": "Query and AI answer within a conversation",
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "feedback": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "level": {
+                    "type": "string"
+                },
+                "query": {
+                    "type": "string"
+                },
+                "response": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.ConversationRequest": {
+            "description": "Conversation title; an empty title on create is filled in from the first query",
+            "type": "object",
+            "properties": {
+                "title": {
+                    "type": "string",
+                    "example": "Python file handling"
+                }
+            }
+        },
+        "handlers.ConversationResponse": {
+            "description": "Conversation thread",
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Python file handling"
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.FallbackConfig": {
+            "type": "object",
+            "properties": {
+                "ai_model": {
+                    "type": "string"
+                },
+                "ai_provider": {
+                    "type": "string"
+                },
+                "api_key": {
+                    "description": "raw API key; server will encrypt this",
+                    "type": "string"
+                },
+                "api_url": {
+                    "type": "string"
                 },
-                "encrypted_api_key": {
-                    "type": "string",
-                    "example": "encrypted_key_data"
+                "api_version": {
+                    "type": "string"
                 },
-                "prompts": {
-                    "type": "object",
-                    "additionalProperties": {
-                        "type": "string"
-                    },
-                    "example": {
-                        "expert": "Detailed analysis",
-                        "novice": "Simple explanation"
-                    }
+                "deployment": {
+                    "type": "string"
                 },
-                "temperature": {
-                    "type": "number",
-                    "example": 0.7
+                "endpoint": {
+                    "type": "string"
                 }
             }
         },
-        "handlers.AnalyzeRequest": {
-            "description": "Request structure for code analysis",
+        "handlers.FeedbackRequest": {
+            "description": "Feedback on an answer, or on one suggestion of an analysis when suggestion_id is set. At least one of feedback, rating or comment is required. A rating without a vote counts as positive (4-5), neutral (3) or negative (1-2).",
             "type": "object",
             "required": [
-                "code",
-                "level"
+                "id"
             ],
             "properties": {
-                "code": {
+                "comment": {
                     "type": "string",
-                    "example": "def hello_world():\n    print('Hello, World!')"
+                    "example": "Clear explanation, but the example did not compile"
                 },
-                "includeLineNumbers": {
-                    "type": "boolean",
-                    "example": true
-                },
-                "level": {
+                "feedback": {
                     "type": "string",
                     "enum": [
-                        "beginner",
-                        "intermediate",
-                        "advanced"
+                        "positive",
+                        "negative",
+                        "neutral"
                     ],
-                    "example": "beginner"
-                }
-            }
-        },
-        "handlers.AnalyzeResponse": {
-            "description": "Response structure for code analysis results",
-            "type": "object",
-            "properties": {
-                "suggestions": {
+                    "example": "positive"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "rating": {
+                    "type": "integer",
+                    "maximum": 5,
+                    "minimum": 1,
+                    "example": 4
+                },
+                "reasons": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/handlers.Suggestion"
-                    }
+                        "type": "string",
+                        "enum": [
+                            "wrong",
+                            "too_advanced",
+                            "too_basic",
+                            "unclear",
+                            "incomplete",
+                            "off_topic"
+                        ]
+                    },
+                    "example": [
+                        "unclear"
+                    ]
+                },
+                "suggestion_id": {
+                    "type": "integer",
+                    "example": 42
                 }
             }
         },
-        "handlers.FeedbackRequest": {
-            "description": "Feedback request structure",
+        "handlers.HistoryItem": {
+            "description": "Past query or code analysis with its AI answer",
             "type": "object",
-            "required": [
-                "feedback",
-                "id"
-            ],
             "properties": {
+                "completion_tokens": {
+                    "type": "integer"
+                },
+                "conversation_id": {
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
                 "feedback": {
                     "type": "string",
-                    "enum": [
-                        "positive",
-                        "negative",
-                        "neutral"
-                    ],
                     "example": "positive"
                 },
                 "id": {
                     "type": "string",
                     "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "latency_ms": {
+                    "type": "integer"
+                },
+                "level": {
+                    "type": "string",
+                    "example": "novice"
+                },
+                "model": {
+                    "type": "string",
+                    "example": "llama-3.3-70b-versatile"
+                },
+                "prompt_tokens": {
+                    "type": "integer"
+                },
+                "provider": {
+                    "type": "string",
+                    "example": "groq"
+                },
+                "query": {
+                    "type": "string",
+                    "example": "How do I create a new file in Python?"
+                },
+                "response": {
+                    "type": "string"
+                },
+                "service": {
+                    "type": "string",
+                    "example": "query"
+                },
+                "total_tokens": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.HistoryResponse": {
+            "description": "Page of past queries, newest first",
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.HistoryItem"
+                    }
+                },
+                "next_cursor": {
+                    "description": "Pass as cursor to fetch the next page; omitted on the last page",
+                    "type": "string"
                 }
             }
         },
@@ -660,6 +1872,19 @@ const docTemplate = `{
                 }
             }
         },
+        "handlers.Position": {
+            "type": "object",
+            "properties": {
+                "character": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "line": {
+                    "type": "integer",
+                    "example": 0
+                }
+            }
+        },
         "handlers.ProfileResponse": {
             "type": "object",
             "properties": {
@@ -710,6 +1935,20 @@ const docTemplate = `{
             ],
             "properties": {
                 "context": {},
+                "conversation_id": {
+                    "description": "Continue a stored conversation of the signed-in user; its earlier turns are loaded from the database instead of the context",
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "filename": {
+                    "type": "string",
+                    "example": "hello.py"
+                },
+                "language": {
+                    "description": "Language ID as used by VS Code; taken from the editor context or detected when omitted",
+                    "type": "string",
+                    "example": "python"
+                },
                 "level": {
                     "type": "string",
                     "enum": [
@@ -729,16 +1968,41 @@ const docTemplate = `{
             "description": "Response structure for AI query results",
             "type": "object",
             "properties": {
+                "cached": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "conversation_id": {
+                    "description": "Conversation the query was stored in, omitted for one-off queries",
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
                 "id": {
                     "type": "string",
                     "example": "550e8400-e29b-41d4-a716-446655440000"
                 },
+                "language": {
+                    "description": "Given or detected language of the code the query is about, omitted when unknown",
+                    "type": "string",
+                    "example": "python"
+                },
                 "response": {
                     "type": "string",
                     "example": "To create a new file in Python, you can use the open() function with 'w' mode..."
                 }
             }
         },
+        "handlers.Range": {
+            "type": "object",
+            "properties": {
+                "end": {
+                    "$ref": "#/definitions/handlers.Position"
+                },
+                "start": {
+                    "$ref": "#/definitions/handlers.Position"
+                }
+            }
+        },
         "handlers.RegisterRequest": {
             "description": "Registration request structure",
             "type": "object",
@@ -772,6 +2036,92 @@ const docTemplate = `{
                 }
             }
         },
+        "handlers.SearchResponse": {
+            "description": "Page of search results, best match first",
+            "type": "object",
+            "properties": {
+                "next_offset": {
+                    "description": "Pass as offset to fetch the next page; omitted on the last page",
+                    "type": "integer"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.SearchResultItem"
+                    }
+                }
+            }
+        },
+        "handlers.SearchResultItem": {
+            "description": "Past query matched by a full-text search, with highlighted snippets",
+            "type": "object",
+            "properties": {
+                "completion_tokens": {
+                    "type": "integer"
+                },
+                "conversation_id": {
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "feedback": {
+                    "type": "string",
+                    "example": "positive"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "550e8400-e29b-41d4-a716-446655440000"
+                },
+                "latency_ms": {
+                    "type": "integer"
+                },
+                "level": {
+                    "type": "string",
+                    "example": "novice"
+                },
+                "model": {
+                    "type": "string",
+                    "example": "llama-3.3-70b-versatile"
+                },
+                "prompt_tokens": {
+                    "type": "integer"
+                },
+                "provider": {
+                    "type": "string",
+                    "example": "groq"
+                },
+                "query": {
+                    "type": "string",
+                    "example": "How do I create a new file in Python?"
+                },
+                "query_snippet": {
+                    "description": "Matching part of the query, terms wrapped in \u003cmark\u003e\u003c/mark\u003e",
+                    "type": "string"
+                },
+                "rank": {
+                    "type": "number"
+                },
+                "response": {
+                    "type": "string"
+                },
+                "response_snippet": {
+                    "description": "Matching part of the answer, terms wrapped in \u003cmark\u003e\u003c/mark\u003e",
+                    "type": "string"
+                },
+                "service": {
+                    "type": "string",
+                    "example": "query"
+                },
+                "total_tokens": {
+                    "type": "integer"
+                },
+                "user_id": {
+                    "description": "Only set for admin searches across all users",
+                    "type": "integer"
+                }
+            }
+        },
         "handlers.ServiceConfig": {
             "type": "object",
             "properties": {
@@ -795,16 +2145,61 @@ const docTemplate = `{
                             "description": "API endpoint URL for the provider",
                             "type": "string"
                         },
+                        "api_version": {
+                            "description": "Azure OpenAI API version, substituted for {api_version}",
+                            "type": "string"
+                        },
+                        "cache": {
+                            "description": "opt-in response cache for identical prompts",
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/services.CacheSettings"
+                                }
+                            ]
+                        },
+                        "circuit_breaker": {
+                            "description": "circuit breaker thresholds for the providers of this service",
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/services.CircuitBreakerSettings"
+                                }
+                            ]
+                        },
+                        "deployment": {
+                            "description": "Azure OpenAI deployment name, substituted for {deployment}",
+                            "type": "string"
+                        },
+                        "endpoint": {
+                            "description": "Azure OpenAI resource name, substituted for {endpoint}",
+                            "type": "string"
+                        },
+                        "fallbacks": {
+                            "description": "ordered providers tried when the primary fails with a transport error, 429 or 5xx",
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handlers.FallbackConfig"
+                            }
+                        },
                         "prompts": {
-                            "description": "named prompts",
+                            "description": "prompts by level; an object value holds the level prompts of one language, e.g. \"go\": {\"novice\": \"...\"}",
                             "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "additionalProperties": true
+                        },
+                        "retry": {
+                            "description": "retry policy applied to each provider before falling back",
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/services.RetryPolicy"
+                                }
+                            ]
                         },
                         "temperature": {
                             "description": "AI model temperature",
                             "type": "number"
+                        },
+                        "timeout_seconds": {
+                            "description": "deadline in seconds for a whole AI call, including retries and fallbacks",
+                            "type": "integer"
                         }
                     }
                 },
@@ -815,17 +2210,46 @@ const docTemplate = `{
             }
         },
         "handlers.Suggestion": {
-            "description": "Individual suggestion from code analysis",
+            "description": "Individual suggestion from code analysis. Line repeats range.start.line for older clients.",
             "type": "object",
             "properties": {
+                "category": {
+                    "type": "string",
+                    "enum": [
+                        "bug",
+                        "style",
+                        "performance",
+                        "security",
+                        "readability"
+                    ],
+                    "example": "readability"
+                },
+                "code": {
+                    "description": "Stable rule identifier, category/rule",
+                    "type": "string",
+                    "example": "readability/missing-docstring"
+                },
                 "diff": {
+                    "description": "Unified diff of the fix, or \"- old\\n+ new\" when its snippet was not found",
                     "type": "string",
-                    "example": "- old_code\n+ new_code"
+                    "example": "--- a/code\n+++ b/code\n@@ -1,1 +1,1 @@\n-old_code\n+new_code\n"
+                },
+                "edits": {
+                    "description": "LSP-style edits that apply the fix to the submitted code",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.TextEdit"
+                    }
                 },
                 "explanation": {
                     "type": "string",
                     "example": "Adding a docstring improves code readability"
                 },
+                "id": {
+                    "description": "Pass as suggestion_id to /feedback",
+                    "type": "integer",
+                    "example": 42
+                },
                 "line": {
                     "type": "integer",
                     "example": 0
@@ -833,6 +2257,85 @@ const docTemplate = `{
                 "message": {
                     "type": "string",
                     "example": "Consider adding docstring"
+                },
+                "range": {
+                    "$ref": "#/definitions/handlers.Range"
+                },
+                "severity": {
+                    "type": "string",
+                    "enum": [
+                        "error",
+                        "warning",
+                        "info",
+                        "hint"
+                    ],
+                    "example": "info"
+                },
+                "snippetNotFound": {
+                    "description": "The fix's \"before\" snippet does not occur in the submitted code, so it cannot be applied",
+                    "type": "boolean"
+                }
+            }
+        },
+        "handlers.TextEdit": {
+            "type": "object",
+            "properties": {
+                "newText": {
+                    "type": "string",
+                    "example": "counter_index = 5"
+                },
+                "range": {
+                    "$ref": "#/definitions/handlers.Range"
+                }
+            }
+        },
+        "services.CacheSettings": {
+            "type": "object",
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "store": {
+                    "description": "\"memory\" (default) or \"postgres\" to share entries across instances",
+                    "type": "string"
+                },
+                "ttl_seconds": {
+                    "description": "How long an entry stays valid",
+                    "type": "integer"
+                }
+            }
+        },
+        "services.CircuitBreakerSettings": {
+            "type": "object",
+            "properties": {
+                "failure_threshold": {
+                    "description": "Consecutive failures that open the circuit",
+                    "type": "integer"
+                },
+                "half_open_max_requests": {
+                    "description": "Concurrent probe calls allowed while half-open",
+                    "type": "integer"
+                },
+                "open_seconds": {
+                    "description": "Time the circuit stays open before probing",
+                    "type": "integer"
+                }
+            }
+        },
+        "services.RetryPolicy": {
+            "type": "object",
+            "properties": {
+                "initial_backoff_ms": {
+                    "description": "Backoff before the first retry",
+                    "type": "integer"
+                },
+                "max_attempts": {
+                    "description": "Total attempts per provider, including the first",
+                    "type": "integer"
+                },
+                "max_backoff_ms": {
+                    "description": "Upper bound for any single wait, including Retry-After",
+                    "type": "integer"
                 }
             }
         }
@@ -3,6 +3,8 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/logger"
 	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/services"
@@ -184,3 +186,202 @@ func DeleteUserHandler(dbService *services.DBService) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 	}
 }
+
+// GetUsageStatsHandler returns token usage and latency aggregated per service, provider, model and user.
+// The user_id query parameter restricts the stats to one user.
+func GetUsageStatsHandler(dbService *services.DBService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+		if err != nil || days <= 0 {
+			logger.Log.Errorf("GetUsageStatsHandler: Invalid days parameter: %s", c.Query("days"))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days parameter"})
+			return
+		}
+
+		var userID *int
+		if raw := c.Query("user_id"); raw != "" {
+			id, err := strconv.Atoi(raw)
+			if err != nil || id <= 0 {
+				logger.Log.Errorf("GetUsageStatsHandler: Invalid user_id parameter: %s", raw)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id parameter"})
+				return
+			}
+			userID = &id
+		}
+
+		since := time.Now().AddDate(0, 0, -days)
+		stats, err := dbService.GetUsageStats(c.Request.Context(), since, userID)
+		if err != nil {
+			logger.Log.Errorf("GetUsageStatsHandler: Failed to fetch usage stats: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage stats"})
+			return
+		}
+
+		logger.Log.Infof("GetUsageStatsHandler: Returning %d usage rows for the last %d days", len(stats), days)
+		c.JSON(http.StatusOK, gin.H{
+			"since": since.Format(time.RFC3339),
+			"usage": stats,
+		})
+	}
+}
+
+// maxWorstAnswerExcerpt bounds the query and response excerpts in the worst-rated answers list
+const maxWorstAnswerExcerpt = 300
+
+// WorstRatedAnswer represents a poorly rated answer on the admin feedback dashboard
+type WorstRatedAnswer struct {
+	ID            string   `json:"id"`
+	Service       string   `json:"service"`
+	Level         string   `json:"level"`
+	Provider      string   `json:"provider"`
+	Model         string   `json:"model"`
+	PromptVersion string   `json:"prompt_version"`
+	Query         string   `json:"query"`    // Excerpt, the full text is available from /history/{id}
+	Response      string   `json:"response"` // Excerpt
+	Score         float64  `json:"score"`
+	Feedbacks     int      `json:"feedbacks"`
+	Negative      int      `json:"negative"`
+	Reasons       []string `json:"reasons"`
+	Comments      []string `json:"comments"`
+	CreatedAt     string   `json:"createdAt"`
+}
+
+// GetFeedbackStatsHandler returns vote ratios and average ratings of answers, grouped by the dimensions
+// in group_by (service, level, provider, model, prompt_version) and optionally by day, week or month
+func GetFeedbackStatsHandler(dbService *services.DBService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+		if err != nil || days <= 0 {
+			logger.Log.Errorf("GetFeedbackStatsHandler: Invalid days parameter: %s", c.Query("days"))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days parameter"})
+			return
+		}
+
+		var groupBy []string
+		for _, key := range strings.Split(c.DefaultQuery("group_by", "service"), ",") {
+			key = strings.TrimSpace(key)
+			if key == "" {
+				continue
+			}
+			if !services.IsFeedbackDimension(key) {
+				logger.Log.Errorf("GetFeedbackStatsHandler: Invalid group_by parameter: %s", key)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group_by. Use service, level, provider, model or prompt_version"})
+				return
+			}
+			groupBy = append(groupBy, key)
+		}
+
+		bucket := c.Query("bucket")
+		if bucket != "" && bucket != "day" && bucket != "week" && bucket != "month" {
+			logger.Log.Errorf("GetFeedbackStatsHandler: Invalid bucket parameter: %s", bucket)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bucket. Must be 'day', 'week' or 'month'"})
+			return
+		}
+
+		since := time.Now().AddDate(0, 0, -days)
+		stats, err := dbService.GetFeedbackStats(c.Request.Context(), since, groupBy, bucket)
+		if err != nil {
+			logger.Log.Errorf("GetFeedbackStatsHandler: Failed to fetch feedback stats: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feedback stats"})
+			return
+		}
+
+		logger.Log.Infof("GetFeedbackStatsHandler: Returning %d feedback rows for the last %d days", len(stats), days)
+		c.JSON(http.StatusOK, gin.H{
+			"since":    since.Format(time.RFC3339),
+			"group_by": groupBy,
+			"bucket":   bucket,
+			"feedback": stats,
+		})
+	}
+}
+
+// GetWorstRatedAnswersHandler returns the recent answers with the lowest feedback score
+func GetWorstRatedAnswersHandler(dbService *services.DBService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+		if err != nil || days <= 0 {
+			logger.Log.Errorf("GetWorstRatedAnswersHandler: Invalid days parameter: %s", c.Query("days"))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days parameter"})
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+		if err != nil || limit <= 0 || limit > 100 {
+			logger.Log.Errorf("GetWorstRatedAnswersHandler: Invalid limit parameter: %s", c.Query("limit"))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+			return
+		}
+
+		since := time.Now().AddDate(0, 0, -days)
+		answers, err := dbService.GetWorstRatedAnswers(c.Request.Context(), since, limit)
+		if err != nil {
+			logger.Log.Errorf("GetWorstRatedAnswersHandler: Failed to fetch worst rated answers: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch worst rated answers"})
+			return
+		}
+
+		response := make([]WorstRatedAnswer, 0, len(answers))
+		for _, a := range answers {
+			response = append(response, WorstRatedAnswer{
+				ID:            a.ID,
+				Service:       a.Service,
+				Level:         a.Level,
+				Provider:      a.Provider,
+				Model:         a.Model,
+				PromptVersion: a.PromptVersion,
+				Query:         excerpt(a.Query.Query, maxWorstAnswerExcerpt),
+				Response:      excerpt(a.Response, maxWorstAnswerExcerpt),
+				Score:         a.Score,
+				Feedbacks:     a.Feedbacks,
+				Negative:      a.Negative,
+				Reasons:       a.Reasons,
+				Comments:      a.Comments,
+				CreatedAt:     a.CreatedAt.Format(time.RFC3339),
+			})
+		}
+
+		logger.Log.Infof("GetWorstRatedAnswersHandler: Returning %d answers for the last %d days", len(response), days)
+		c.JSON(http.StatusOK, gin.H{
+			"since":   since.Format(time.RFC3339),
+			"answers": response,
+		})
+	}
+}
+
+// excerpt shortens text to at most maxRunes characters
+func excerpt(text string, maxRunes int) string {
+	runes := []rune(text)
+	if len(runes) <= maxRunes {
+		return text
+	}
+	return string(runes[:maxRunes-3]) + "..."
+}
+
+// PurgeCacheHandler clears the AI response cache, optionally only for one service
+func PurgeCacheHandler(aiService *services.AIService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service := c.Query("service")
+
+		if err := aiService.PurgeCache(c.Request.Context(), service); err != nil {
+			logger.Log.Errorf("PurgeCacheHandler: Failed to purge cache: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge cache"})
+			return
+		}
+
+		if service == "" {
+			logger.Log.Infof("PurgeCacheHandler: Purged response cache for all services")
+		} else {
+			logger.Log.Infof("PurgeCacheHandler: Purged response cache for service %s", service)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Cache purged successfully"})
+	}
+}
+
+// GetProviderHealthHandler returns the circuit breaker state of every provider in use
+func GetProviderHealthHandler(aiService *services.AIService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		health := aiService.ProviderHealth()
+		logger.Log.Debugf("GetProviderHealthHandler: Returning health of %d providers", len(health))
+		c.JSON(http.StatusOK, health)
+	}
+}
@@ -1,13 +1,18 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/logger"
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/models"
 	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/services"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // AnalyzeRequest defines the structure for code analysis requests
@@ -15,22 +20,56 @@ import (
 type AnalyzeRequest struct {
 	Code               string `json:"code" binding:"required" example:"def hello_world():\n    print('Hello, World!')"`
 	Level              string `json:"level" binding:"required" example:"beginner" enums:"beginner,intermediate,advanced"`
-	IncludeLineNumbers bool   `json:"includeLineNumbers" example:"true"`
+	IncludeLineNumbers bool   `json:"includeLineNumbers" example:"true"` // Guess positions from the text when the AI reply has no usable line numbers
+	// Language ID as used by VS Code; taken from the editor context or detected from the filename and code when omitted
+	Language string `json:"language,omitempty" example:"python"`
+	Filename string `json:"filename,omitempty" example:"hello.py"`
+	// Editor context sent by the IDE plugin, whose language and fileName are used when the fields above are empty
+	Context interface{} `json:"context,omitempty"`
+	// Only return suggestions of this severity or worse; all suggestions are still stored
+	MinSeverity string `json:"minSeverity,omitempty" example:"warning" enums:"error,warning,info,hint"`
+}
+
+// Position is a zero-based line and character offset in the submitted code, as in LSP. Characters are
+// counted in UTF-16 code units, so characters outside the Basic Multilingual Plane count twice.
+type Position struct {
+	Line      int `json:"line" example:"0"`
+	Character int `json:"character" example:"4"`
+}
+
+// Range spans the code from Start up to, but not including, End
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
 }
 
 // Suggestion represents a single code analysis suggestion
-// @Description Individual suggestion from code analysis
+// @Description Individual suggestion from code analysis. Line repeats range.start.line for older clients.
 type Suggestion struct {
+	ID          int    `json:"id,omitempty" example:"42"` // Pass as suggestion_id to /feedback
 	Line        int    `json:"line" example:"0"`
+	Range       Range  `json:"range"`
+	Severity    string `json:"severity" example:"info" enums:"error,warning,info,hint"`
+	Category    string `json:"category,omitempty" example:"readability" enums:"bug,style,performance,security,readability"`
+	Code        string `json:"code,omitempty" example:"readability/missing-docstring"` // Stable rule identifier, category/rule
 	Message     string `json:"message" example:"Consider adding docstring"`
 	Explanation string `json:"explanation" example:"Adding a docstring improves code readability"`
-	Diff        string `json:"diff,omitempty" example:"- old_code\n+ new_code"`
+	Diff        string `json:"diff,omitempty" example:"--- a/code\n+++ b/code\n@@ -1,1 +1,1 @@\n-old_code\n+new_code\n"` // Unified diff of the fix, or "- old\n+ new" when its snippet was not found
+	// LSP-style edits that apply the fix to the submitted code
+	Edits []TextEdit `json:"edits,omitempty"`
+	// The fix's "before" snippet does not occur in the submitted code, so it cannot be applied
+	SnippetNotFound bool `json:"snippetNotFound,omitempty"`
+
+	before, after string // Proposed fix as given by the AI
 }
 
 // AnalyzeResponse defines the structure for code analysis responses
 // @Description Response structure for code analysis results
 type AnalyzeResponse struct {
+	ID          string       `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
 	Suggestions []Suggestion `json:"suggestions"`
+	Cached      bool         `json:"cached" example:"false"`
+	Language    string       `json:"language,omitempty" example:"python"` // Given or detected language of the code
 }
 
 // AnalyzeHandler godoc
@@ -41,8 +80,9 @@ type AnalyzeResponse struct {
 // @Produce json
 // @Param request body handlers.AnalyzeRequest true "Code to analyze"
 // @Success 200 {object} handlers.AnalyzeResponse
-// @Failure 400 {object} map[string]string "Invalid request format or level"
+// @Failure 400 {object} map[string]string "Invalid request format, level or language"
 // @Failure 500 {object} map[string]string "Server error"
+// @Failure 504 {object} map[string]string "AI provider timed out"
 // @Router /analyze [post]
 func AnalyzeHandler(aiService *services.AIService, dbService *services.DBService, settingsService *services.SettingsService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -60,59 +100,117 @@ func AnalyzeHandler(aiService *services.AIService, dbService *services.DBService
 			c.JSON(500, gin.H{"error": "Failed to get settings"})
 			return
 		}
-		promptTemplate, ok := ai_settings.Prompts[req.Level]
+		hint, filename, _ := editorHints(req.Context, req.Language, req.Filename)
+		language, ok := resolveLanguage(c, hint, filename, req.Code)
+		if !ok {
+			return
+		}
+		promptTemplate, ok := ai_settings.Prompts.Prompt(language, req.Level)
 		if !ok {
 			logger.Log.Warnf("Invalid level: %s", req.Level)
 			c.JSON(400, gin.H{"error": "Invalid level"})
 			return
 		}
-
-		// Enhance the prompt to include guidance about line numbers
-		enhancedPrompt := promptTemplate
-		if req.IncludeLineNumbers {
-			enhancedPrompt += "\n\nIMPORTANT: For each suggestion, include the exact line number using the format 'Line X:' at the start of the suggestion. For example: 'Line 10: Use a more descriptive variable name'.\n\n"
-			enhancedPrompt += "For each issue, provide:\n"
-			enhancedPrompt += "1. A clear explanation of the problem\n"
-			enhancedPrompt += "2. A specific code improvement suggestion\n"
-			enhancedPrompt += "3. A concrete example showing 'before' and 'after' code\n\n"
-			enhancedPrompt += "Format your response like this:\n"
-			enhancedPrompt += "Line 15: Use meaningful variable names\n"
-			enhancedPrompt += "Problem: The variable name 'i' is not descriptive of its purpose.\n"
-			enhancedPrompt += "Suggestion: Rename to reflect its actual function.\n"
-			enhancedPrompt += "Before: `i = 5`\n"
-			enhancedPrompt += "After: `counterIndex = 5`\n\n"
-			enhancedPrompt += "Focus on the most important improvements that will have the greatest impact on code quality, readability, and maintainability.\n"
-		}
-
-		prompt := enhancedPrompt + req.Code
-		logger.Log.Debugf("Analysis prompt created for level: %s", req.Level)
-
-		// Get AI response
-		response, err := aiService.GetResponse("analyze", ai_settings.AIProvider, ai_settings.AIModel, prompt)
-		if err != nil {
-			logger.Log.Errorf("Failed to get AI response: %v", err)
-			c.JSON(500, gin.H{"error": "Failed to get AI response"})
+		if req.MinSeverity != "" && severityRank(req.MinSeverity) < 0 {
+			c.JSON(400, gin.H{"error": "Invalid minSeverity. Must be 'error', 'warning', 'info' or 'hint'"})
 			return
 		}
 
-		logger.Log.Debugf("Analysis response received, parsing suggestions")
-
-		// Parse the response into a list of suggestions
-		suggestions := parseAnalyzeResponse(response)
+		// Instructions go in the system role; the submitted code is only ever user input
+		messages := []services.ChatMessage{
+			{Role: services.RoleSystem, Content: languagePrompt(promptTemplate, language) + analysisJSONInstructions},
+			{Role: services.RoleUser, Content: req.Code},
+		}
+		logger.Log.Debugf("Analysis prompt created for level %s and language %q", req.Level, language)
 
-		// If no line-specific suggestions were found, try to create them
-		if len(suggestions) == 0 && req.IncludeLineNumbers {
-			logger.Log.Warnf("No line-specific suggestions found, using fallback parsing")
-			suggestions = createFallbackSuggestions(response, req.Code)
+		// Ask for structured suggestions, repairing or scraping the reply when it does not validate
+		response, suggestions, err := requestAnalysis(c.Request.Context(), aiService, ai_settings, messages, req.Code, req.IncludeLineNumbers)
+		if err != nil {
+			respondAIError(c, err)
+			return
+		}
+		logger.Log.Debugf("Analysis response received from %s in %s", response.Provider, response.Latency)
+		attachFixes(suggestions, req.Code, diffName(filename))
+		sortSuggestions(suggestions)
+
+		// Record the call so usage and latency are tracked for analyze too, and the suggestions can receive feedback
+		id := uuid.New().String()
+		query := newQueryRecord(id, "analyze", req.Code, req.Level, currentUserID(c), response)
+		query.PromptVersion = services.PromptVersion(promptTemplate)
+		if err := dbService.CreateQuery(c.Request.Context(), query); err != nil {
+			logger.Log.Errorf("Failed to store analysis: %v", err)
+		} else if err := storeSuggestions(c.Request.Context(), dbService, id, suggestions); err != nil {
+			logger.Log.Errorf("Failed to store suggestions: %v", err)
 		}
 
 		logger.Log.Infof("Analysis complete with %d suggestions", len(suggestions))
+		if req.MinSeverity != "" {
+			suggestions = filterSuggestions(suggestions, req.MinSeverity)
+		}
 
 		// Respond to client
 		c.JSON(200, gin.H{
+			"id":          id,
 			"suggestions": suggestions,
+			"cached":      response.Cached,
+			"language":    language,
+		})
+	}
+}
+
+// severityRank orders severities from most (0) to least severe, returning -1 for unknown values
+func severityRank(severity string) int {
+	return slices.Index(analysisSeverities, severity)
+}
+
+// sortSuggestions orders suggestions by severity, most severe first, then by position in the code
+func sortSuggestions(suggestions []Suggestion) {
+	slices.SortStableFunc(suggestions, func(a, b Suggestion) int {
+		if d := severityRank(a.Severity) - severityRank(b.Severity); d != 0 {
+			return d
+		}
+		if d := a.Range.Start.Line - b.Range.Start.Line; d != 0 {
+			return d
+		}
+		return a.Range.Start.Character - b.Range.Start.Character
+	})
+}
+
+// filterSuggestions keeps the suggestions at least as severe as minSeverity
+func filterSuggestions(suggestions []Suggestion, minSeverity string) []Suggestion {
+	limit := severityRank(minSeverity)
+	filtered := make([]Suggestion, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		if severityRank(suggestion.Severity) <= limit {
+			filtered = append(filtered, suggestion)
+		}
+	}
+	return filtered
+}
+
+// storeSuggestions saves the suggestions of an analysis and copies their database IDs back
+func storeSuggestions(ctx context.Context, dbService *services.DBService, queryID string, suggestions []Suggestion) error {
+	records := make([]models.Suggestion, 0, len(suggestions))
+	for i, suggestion := range suggestions {
+		details, err := json.Marshal(suggestion)
+		if err != nil {
+			return err
+		}
+		records = append(records, models.Suggestion{
+			QueryID:  queryID,
+			Position: i,
+			Line:     suggestion.Line,
+			Message:  suggestion.Message,
+			Details:  details,
 		})
 	}
+	if err := dbService.CreateSuggestions(ctx, records); err != nil {
+		return err
+	}
+	for i := range suggestions {
+		suggestions[i].ID = records[i].ID
+	}
+	return nil
 }
 
 // parseAnalyzeResponse parses the AI response into a list of suggestions with line numbers
@@ -159,13 +257,6 @@ func parseAnalyzeResponse(response string) []Suggestion {
 		beforeMatch := beforePattern.FindStringSubmatch(content)
 		afterMatch := afterPattern.FindStringSubmatch(content)
 
-		diff := ""
-		if len(beforeMatch) > 1 && len(afterMatch) > 1 {
-			before := beforeMatch[1]
-			after := afterMatch[1]
-			diff = strings.Join([]string{"- ", before, "\n+ ", after}, "")
-		}
-
 		// Extract explanation (anything between the title and Before/After examples)
 		explanation := content
 		explanation = strings.TrimPrefix(explanation, strings.Join([]string{"Line ", lineNumStr, ":", title}, ""))
@@ -186,8 +277,10 @@ func parseAnalyzeResponse(response string) []Suggestion {
 			Explanation: explanation,
 		}
 
-		if diff != "" {
-			suggestion.Diff = diff
+		if len(beforeMatch) > 1 && len(afterMatch) > 1 {
+			suggestion.before = beforeMatch[1]
+			suggestion.after = afterMatch[1]
+			suggestion.Diff = snippetDiff(suggestion.before, suggestion.after)
 		}
 
 		suggestions = append(suggestions, suggestion)
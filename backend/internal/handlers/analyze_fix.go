@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/logger"
+)
+
+// diffContextLines is the number of unchanged lines shown around a change in unified diffs
+const diffContextLines = 3
+
+// diffFileName names the submitted code in diff headers when the request has no filename
+const diffFileName = "code"
+
+// TextEdit replaces the text of Range with NewText, as in LSP
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText" example:"counter_index = 5"`
+}
+
+// attachFixes places the proposed fix of each suggestion in the submitted code. Fixes that apply get a
+// unified diff and text edits; the others keep their snippet diff and are marked as not found.
+func attachFixes(suggestions []Suggestion, code, name string) {
+	for i := range suggestions {
+		s := &suggestions[i]
+		if s.before == "" && s.after == "" {
+			continue
+		}
+		edit, fixed, err := buildFix(code, s.before, s.after, s.Range.Start.Line)
+		if err != nil {
+			logger.Log.Debugf("Fix for suggestion %q not applied: %v", s.Message, err)
+			s.SnippetNotFound = true
+			continue
+		}
+		s.Edits = []TextEdit{*edit}
+		s.Diff = unifiedDiff(name, code, fixed)
+	}
+}
+
+// buildFix locates before in code, preferring the occurrence closest to nearLine, and returns the edit
+// replacing it with after together with the fixed code. The edit is applied by its range to make sure
+// it reproduces the intended change.
+func buildFix(code, before, after string, nearLine int) (*TextEdit, string, error) {
+	start, end, wholeLines := locateSnippet(code, before, nearLine)
+	if start < 0 {
+		return nil, "", errors.New("snippet not found in the code")
+	}
+
+	newText := after
+	if !strings.HasSuffix(code[start:end], "\n") {
+		newText = strings.TrimSuffix(newText, "\n")
+	}
+	if wholeLines {
+		newText = reindent(newText, leadingWhitespace(code[start:end]))
+	}
+
+	edit := &TextEdit{
+		Range:   Range{Start: offsetPosition(code, start), End: offsetPosition(code, end)},
+		NewText: newText,
+	}
+	fixed, err := applyTextEdit(code, edit)
+	if err != nil {
+		return nil, "", err
+	}
+	if fixed != code[:start]+newText+code[end:] {
+		return nil, "", errors.New("edit does not reproduce the fix")
+	}
+	if fixed == code {
+		return nil, "", errors.New("fix does not change the code")
+	}
+	return edit, fixed, nil
+}
+
+// locateSnippet returns the byte range of snippet in code. An exact match is tried first; otherwise
+// the snippet is matched line by line ignoring indentation and trailing spaces, and the range covers
+// the whole matched lines. wholeLines also reports exact matches that span complete lines, so their
+// replacement is indented like them. start is -1 when the snippet is not found.
+func locateSnippet(code, snippet string, nearLine int) (start, end int, wholeLines bool) {
+	start = -1
+	if strings.TrimSpace(snippet) == "" {
+		return -1, -1, false
+	}
+
+	best := -1
+	for offset := 0; ; {
+		i := strings.Index(code[offset:], snippet)
+		if i < 0 {
+			break
+		}
+		i += offset
+		line := strings.Count(code[:i], "\n")
+		if start < 0 || abs(line-nearLine) < best {
+			start, end, best = i, i+len(snippet), abs(line-nearLine)
+		}
+		offset = i + 1
+	}
+	if start >= 0 {
+		return start, end, lineAligned(code, start, end)
+	}
+
+	want := strings.Split(strings.Trim(snippet, "\r\n"), "\n")
+	for i := range want {
+		want[i] = strings.TrimSpace(want[i])
+	}
+	codeLines := strings.Split(code, "\n")
+	lineOffsets := make([]int, len(codeLines))
+	for i, offset := 1, 0; i < len(codeLines); i++ {
+		offset += len(codeLines[i-1]) + 1
+		lineOffsets[i] = offset
+	}
+	for i := 0; i+len(want) <= len(codeLines); i++ {
+		matched := true
+		for k, w := range want {
+			if strings.TrimSpace(codeLines[i+k]) != w {
+				matched = false
+				break
+			}
+		}
+		if matched && (start < 0 || abs(i-nearLine) < best) {
+			last := i + len(want) - 1
+			start = lineOffsets[i]
+			end = lineOffsets[last] + len(strings.TrimSuffix(codeLines[last], "\r"))
+			best = abs(i - nearLine)
+		}
+	}
+	return start, end, start >= 0
+}
+
+// lineAligned reports whether the byte range from start to end begins and ends at line boundaries
+func lineAligned(code string, start, end int) bool {
+	startsLine := start == 0 || code[start-1] == '\n'
+	endsLine := end == len(code) || code[end-1] == '\n' || code[end] == '\n' || code[end] == '\r'
+	return startsLine && endsLine
+}
+
+// reindent prefixes the lines of text with indent when the text carries no indentation of its own
+func reindent(text, indent string) string {
+	if indent == "" || leadingWhitespace(text) != "" {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = indent + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// leadingWhitespace returns the indentation of the first line of s
+func leadingWhitespace(s string) string {
+	return s[:len(s)-len(strings.TrimLeftFunc(s, func(r rune) bool { return r == ' ' || r == '\t' }))]
+}
+
+// offsetPosition converts a byte offset in code to a line and character position
+func offsetPosition(code string, offset int) Position {
+	lineStart := strings.LastIndex(code[:offset], "\n") + 1
+	return Position{
+		Line:      strings.Count(code[:offset], "\n"),
+		Character: utf16Len(code[lineStart:offset]),
+	}
+}
+
+// utf16Len counts the UTF-16 code units of s; invalid bytes count as one replacement character each
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// positionOffset converts a line and character position to a byte offset in code
+func positionOffset(code string, pos Position) (int, error) {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(code[offset:], '\n')
+		if i < 0 {
+			return 0, fmt.Errorf("line %d is outside the code", pos.Line)
+		}
+		offset += i + 1
+	}
+	for units := 0; units < pos.Character; {
+		if offset >= len(code) || code[offset] == '\n' {
+			return 0, fmt.Errorf("character %d is outside line %d", pos.Character, pos.Line)
+		}
+		r, size := utf8.DecodeRuneInString(code[offset:])
+		units += utf16.RuneLen(r)
+		offset += size
+		if units > pos.Character {
+			return 0, fmt.Errorf("character %d splits a surrogate pair on line %d", pos.Character, pos.Line)
+		}
+	}
+	return offset, nil
+}
+
+// applyTextEdit returns code with the edit applied
+func applyTextEdit(code string, edit *TextEdit) (string, error) {
+	start, err := positionOffset(code, edit.Range.Start)
+	if err != nil {
+		return "", err
+	}
+	end, err := positionOffset(code, edit.Range.End)
+	if err != nil {
+		return "", err
+	}
+	if end < start {
+		return "", errors.New("edit range ends before it starts")
+	}
+	return code[:start] + edit.NewText + code[end:], nil
+}
+
+// unifiedDiff renders the change from oldText to newText as a single-hunk unified diff, which is
+// exact for the one contiguous change a fix makes
+func unifiedDiff(name, oldText, newText string) string {
+	oldLines, newLines := diffLines(oldText), diffLines(newText)
+
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+	if prefix == len(oldLines) && prefix == len(newLines) {
+		return ""
+	}
+
+	first := max(prefix-diffContextLines, 0)
+	trailing := min(suffix, diffContextLines)
+	oldEnd := len(oldLines) - suffix
+	newEnd := len(newLines) - suffix
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", name, name)
+	fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(first, oldEnd+trailing-first), hunkRange(first, newEnd+trailing-first))
+	for _, line := range oldLines[first:prefix] {
+		writeDiffLine(&b, ' ', line)
+	}
+	for _, line := range oldLines[prefix:oldEnd] {
+		writeDiffLine(&b, '-', line)
+	}
+	for _, line := range newLines[prefix:newEnd] {
+		writeDiffLine(&b, '+', line)
+	}
+	for _, line := range oldLines[oldEnd : oldEnd+trailing] {
+		writeDiffLine(&b, ' ', line)
+	}
+	return b.String()
+}
+
+// writeDiffLine writes a line of a hunk, marking a last line that has no terminating newline the way
+// diff does so that patch and git apply accept the diff
+func writeDiffLine(b *strings.Builder, marker byte, line string) {
+	b.WriteByte(marker)
+	b.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		b.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// hunkRange formats the start,count part of a hunk header; empty ranges point at the line before them
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// diffLines splits text into lines, each keeping its newline so that a last line without one never
+// compares equal to the same text followed by a newline
+func diffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
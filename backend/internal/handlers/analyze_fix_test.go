@@ -0,0 +1,70 @@
+package handlers
+
+import "testing"
+
+func TestAttachFixes(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		item     string
+		wantEdit TextEdit
+		wantDiff string
+	}{
+		{
+			name: "replacement of whole indented lines keeps their indentation",
+			code: "def f():\n    x = 1\n    return x\n",
+			item: `{"line": 2, "severity": "info", "category": "style", "message": "m", "replacement": "y = 1"}`,
+			wantEdit: TextEdit{
+				Range:   Range{Start: Position{Line: 1, Character: 0}, End: Position{Line: 1, Character: 9}},
+				NewText: "    y = 1",
+			},
+			wantDiff: "--- a/code\n+++ b/code\n@@ -1,3 +1,3 @@\n def f():\n-    x = 1\n+    y = 1\n     return x\n",
+		},
+		{
+			name: "characters outside the BMP count as two UTF-16 code units",
+			code: "s = \"héllo 😀\"; n = 1\n",
+			item: `{"line": 1, "severity": "info", "category": "style", "message": "m", "original": "n = 1", "replacement": "n = 2"}`,
+			wantEdit: TextEdit{
+				Range:   Range{Start: Position{Line: 0, Character: 16}, End: Position{Line: 0, Character: 21}},
+				NewText: "n = 2",
+			},
+			wantDiff: "--- a/code\n+++ b/code\n@@ -1,1 +1,1 @@\n-s = \"héllo 😀\"; n = 1\n+s = \"héllo 😀\"; n = 2\n",
+		},
+		{
+			name: "missing final newline is marked in the diff",
+			code: "a = 1\n    b = 2",
+			item: `{"line": 2, "severity": "info", "category": "style", "message": "m", "original": "    b = 2", "replacement": "b = 3"}`,
+			wantEdit: TextEdit{
+				Range:   Range{Start: Position{Line: 1, Character: 0}, End: Position{Line: 1, Character: 9}},
+				NewText: "    b = 3",
+			},
+			wantDiff: "--- a/code\n+++ b/code\n@@ -1,2 +1,2 @@\n a = 1\n-    b = 2\n\\ No newline at end of file\n+    b = 3\n\\ No newline at end of file\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suggestions, err := parseStructuredAnalysis(`{"suggestions": [`+tt.item+`]}`, tt.code)
+			if err != nil {
+				t.Fatalf("parseStructuredAnalysis: %v", err)
+			}
+			attachFixes(suggestions, tt.code, diffFileName)
+
+			s := suggestions[0]
+			if s.SnippetNotFound || len(s.Edits) != 1 {
+				t.Fatalf("fix not applied: %+v", s)
+			}
+			if s.Edits[0] != tt.wantEdit {
+				t.Errorf("edit = %+v, want %+v", s.Edits[0], tt.wantEdit)
+			}
+			if s.Diff != tt.wantDiff {
+				t.Errorf("diff = %q, want %q", s.Diff, tt.wantDiff)
+			}
+			if fixed, err := applyTextEdit(tt.code, &s.Edits[0]); err != nil {
+				t.Errorf("applyTextEdit: %v", err)
+			} else if got := unifiedDiff(diffFileName, tt.code, fixed); got != s.Diff {
+				t.Errorf("edit and diff disagree: edit gives %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/logger"
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/services"
+)
+
+// maxRuleLength bounds the rule part of a suggestion code
+const maxRuleLength = 40
+
+// Accepted values of the severity and category fields of a structured suggestion, severities from most to least severe
+var (
+	analysisSeverities = []string{"error", "warning", "info", "hint"}
+	analysisCategories = []string{"bug", "style", "performance", "security", "readability"}
+)
+
+// analysisSchema is the JSON object requested from the provider for a code analysis
+var analysisSchema = &services.ResponseSchema{
+	Name:        "report_code_analysis",
+	Description: "Report the suggestions found while reviewing the submitted code",
+	Schema: map[string]interface{}{
+		"type":     "object",
+		"required": []string{"suggestions"},
+		"properties": map[string]interface{}{
+			"suggestions": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"line", "severity", "category", "message", "explanation"},
+					"properties": map[string]interface{}{
+						"line":        map[string]interface{}{"type": "integer", "minimum": 1, "description": "First affected line, 1-based"},
+						"end_line":    map[string]interface{}{"type": "integer", "minimum": 1, "description": "Last affected line, 1-based; defaults to line"},
+						"column":      map[string]interface{}{"type": "integer", "minimum": 1, "description": "First affected character on line, 1-based; defaults to the first non-blank character"},
+						"end_column":  map[string]interface{}{"type": "integer", "minimum": 1, "description": "Last affected character on end_line, 1-based; defaults to the end of the line"},
+						"rule":        map[string]interface{}{"type": "string", "description": "Short kebab-case name of the rule, reused for the same kind of issue, e.g. unused-variable"},
+						"severity":    map[string]interface{}{"type": "string", "enum": analysisSeverities},
+						"category":    map[string]interface{}{"type": "string", "enum": analysisCategories},
+						"message":     map[string]interface{}{"type": "string", "description": "One-line summary of the issue"},
+						"explanation": map[string]interface{}{"type": "string", "description": "Why it matters and how to fix it"},
+						"original":    map[string]interface{}{"type": "string", "description": "Exact code replaced by replacement, copied verbatim; defaults to lines line..end_line"},
+						"replacement": map[string]interface{}{"type": "string", "description": "Code replacing original, omitted when there is no concrete fix"},
+					},
+				},
+			},
+		},
+	},
+}
+
+// analysisJSONInstructions is appended to the level prompt; providers without JSON mode rely on it alone
+const analysisJSONInstructions = `
+
+Reply with a single JSON object and nothing else, in this shape:
+{"suggestions": [{"line": 3, "end_line": 4, "column": 5, "end_column": 20, "severity": "warning", "category": "bug", "rule": "unclosed-file", "message": "One-line summary", "explanation": "Why it matters and how to fix it", "original": "f = open(path)", "replacement": "with open(path) as f:"}]}
+
+- line and end_line are 1-based line numbers of the submitted code; end_line may be omitted for a single line.
+- column and end_column are the 1-based first and last characters of the issue; omit them to mark whole lines.
+- rule is a short kebab-case name for the kind of issue; use the same name whenever the same kind of issue appears.
+- severity is one of: ` + "error, warning, info, hint" + `.
+- category is one of: ` + "bug, style, performance, security, readability" + `.
+- original is the exact code being changed, copied character for character from the submission; replacement is its new text, keeping the indentation. Omit both when there is no concrete fix.
+- Focus on the most important improvements. Return {"suggestions": []} when there is nothing to improve.`
+
+// structuredSuggestion is one suggestion as returned by the provider
+type structuredSuggestion struct {
+	Line        int     `json:"line"`
+	EndLine     int     `json:"end_line"`
+	Column      int     `json:"column"`
+	EndColumn   int     `json:"end_column"`
+	Rule        string  `json:"rule"`
+	Severity    string  `json:"severity"`
+	Category    string  `json:"category"`
+	Message     string  `json:"message"`
+	Explanation string  `json:"explanation"`
+	Original    string  `json:"original"`
+	Replacement *string `json:"replacement"`
+}
+
+// errAnalysisNotJSON marks replies that contain no JSON object at all
+var errAnalysisNotJSON = errors.New("reply is not a valid JSON object")
+
+// requestAnalysis asks the provider for a structured analysis of code. An invalid reply is sent back once
+// with the validation errors; if the repaired reply is invalid too, the suggestions that do validate are
+// kept and the rest dropped. Only when neither reply is JSON are suggestions scraped from the text of
+// the first reply with the legacy parsers.
+func requestAnalysis(ctx context.Context, aiService *services.AIService, settings *services.AiSettings, messages []services.ChatMessage, code string, includeLineNumbers bool) (*services.AIResponse, []Suggestion, error) {
+	// Only replies that validate completely are cached
+	validate := func(content string) error {
+		_, err := parseStructuredAnalysis(content, code)
+		return err
+	}
+	response, err := aiService.GetJSONResponse(ctx, "analyze", settings.AIProvider, settings.AIModel, messages, analysisSchema, validate)
+	if err != nil {
+		return nil, nil, err
+	}
+	suggestions, invalid := parseStructuredAnalysis(response.Content, code)
+	if invalid == nil {
+		return response, suggestions, nil
+	}
+	logger.Log.Warnf("Invalid structured analysis from %s, asking for a repair: %v", response.Provider, invalid)
+	text := response.Content
+	firstValid, firstIsJSON := suggestions, !errors.Is(invalid, errAnalysisNotJSON)
+
+	repairMessages := append(messages[:len(messages):len(messages)],
+		services.ChatMessage{Role: services.RoleAssistant, Content: response.Content},
+		services.ChatMessage{Role: services.RoleUser, Content: "Your reply did not match the required JSON format: " + invalid.Error() +
+			". Reply again with only the corrected JSON object."},
+	)
+	repaired, err := aiService.GetJSONResponse(ctx, "analyze", settings.AIProvider, settings.AIModel, repairMessages, analysisSchema, validate)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, err
+		}
+		logger.Log.Warnf("Repair request for structured analysis failed: %v", err)
+	} else {
+		// The stored record covers both calls
+		repaired.Usage.PromptTokens += response.Usage.PromptTokens
+		repaired.Usage.CompletionTokens += response.Usage.CompletionTokens
+		repaired.Usage.TotalTokens += response.Usage.TotalTokens
+		repaired.Latency += response.Latency
+		response = repaired
+		if suggestions, invalid = parseStructuredAnalysis(repaired.Content, code); invalid == nil {
+			return response, suggestions, nil
+		}
+		logger.Log.Warnf("Repaired structured analysis is still invalid: %v", invalid)
+		if !errors.Is(invalid, errAnalysisNotJSON) {
+			logger.Log.Warnf("Keeping the %d valid suggestions of the repaired analysis", len(suggestions))
+			return response, suggestions, nil
+		}
+	}
+	if firstIsJSON {
+		logger.Log.Warnf("Keeping the %d valid suggestions of the first analysis", len(firstValid))
+		return response, firstValid, nil
+	}
+
+	// Last resort: scrape "Line N:" sections, then guess positions from the paragraphs
+	suggestions = parseAnalyzeResponse(text)
+	if len(suggestions) == 0 && includeLineNumbers {
+		logger.Log.Warnf("No line-specific suggestions found, using fallback parsing")
+		suggestions = createFallbackSuggestions(text, code)
+	}
+	codeLines := splitCodeLines(code)
+	for i := range suggestions {
+		// The legacy formats only know whole lines and carry no classification
+		line := min(max(suggestions[i].Line, 0), len(codeLines)-1)
+		suggestions[i].Line = line
+		suggestions[i].Range = Range{
+			Start: Position{Line: line, Character: utf16Column(codeLines[line], firstNonBlank(codeLines[line]))},
+			End:   Position{Line: line, Character: utf16Column(codeLines[line], lineLength(codeLines[line]))},
+		}
+		suggestions[i].Severity = "info"
+	}
+	return response, suggestions, nil
+}
+
+// parseStructuredAnalysis decodes and validates a structured analysis against the submitted code.
+// It returns the suggestions that validate even when others do not; the error lists every problem
+// found so it can be fed back to the provider, and is errAnalysisNotJSON when there is no JSON.
+func parseStructuredAnalysis(content, code string) ([]Suggestion, error) {
+	object := []byte(extractJSONObject(content))
+	if !json.Valid(object) {
+		return nil, errAnalysisNotJSON
+	}
+	var analysis struct {
+		Suggestions *[]json.RawMessage `json:"suggestions"`
+	}
+	if err := json.Unmarshal(object, &analysis); err != nil || analysis.Suggestions == nil {
+		return nil, errors.New(`the reply must have a "suggestions" array`)
+	}
+
+	codeLines := splitCodeLines(code)
+	var problems []string
+	suggestions := make([]Suggestion, 0, len(*analysis.Suggestions))
+	for i, raw := range *analysis.Suggestions {
+		var s structuredSuggestion
+		if err := json.Unmarshal(raw, &s); err != nil {
+			problems = append(problems, fmt.Sprintf("suggestions[%d]: %v", i, err))
+			continue
+		}
+		if s.EndLine == 0 {
+			s.EndLine = s.Line
+		}
+		s.Severity = strings.ToLower(strings.TrimSpace(s.Severity))
+		s.Category = strings.ToLower(strings.TrimSpace(s.Category))
+		s.Message = strings.TrimSpace(s.Message)
+
+		var itemProblems []string
+		if s.Line < 1 || s.Line > len(codeLines) {
+			itemProblems = append(itemProblems, fmt.Sprintf("line %d is outside the code (1-%d)", s.Line, len(codeLines)))
+		} else if s.EndLine < s.Line || s.EndLine > len(codeLines) {
+			itemProblems = append(itemProblems, fmt.Sprintf("end_line %d must be between line %d and %d", s.EndLine, s.Line, len(codeLines)))
+		} else {
+			if s.Column == 0 {
+				s.Column = firstNonBlank(codeLines[s.Line-1]) + 1
+			}
+			if s.EndColumn == 0 {
+				s.EndColumn = lineLength(codeLines[s.EndLine-1])
+			}
+			if s.Column < 1 || s.Column > lineLength(codeLines[s.Line-1])+1 {
+				itemProblems = append(itemProblems, fmt.Sprintf("column %d is outside line %d", s.Column, s.Line))
+			} else if s.EndColumn > lineLength(codeLines[s.EndLine-1]) || (s.EndLine == s.Line && s.EndColumn < s.Column-1) {
+				itemProblems = append(itemProblems, fmt.Sprintf("end_column %d is outside line %d or before column", s.EndColumn, s.EndLine))
+			}
+		}
+		if !slices.Contains(analysisSeverities, s.Severity) {
+			itemProblems = append(itemProblems, fmt.Sprintf("severity %q must be one of %s", s.Severity, strings.Join(analysisSeverities, ", ")))
+		}
+		if !slices.Contains(analysisCategories, s.Category) {
+			itemProblems = append(itemProblems, fmt.Sprintf("category %q must be one of %s", s.Category, strings.Join(analysisCategories, ", ")))
+		}
+		if s.Message == "" {
+			itemProblems = append(itemProblems, "message is empty")
+		}
+		if len(itemProblems) > 0 {
+			problems = append(problems, fmt.Sprintf("suggestions[%d]: %s", i, strings.Join(itemProblems, ", ")))
+			continue
+		}
+
+		// 1-based inclusive columns become zero-based UTF-16 offsets with an exclusive end
+		suggestion := Suggestion{
+			Line: s.Line - 1,
+			Range: Range{
+				Start: Position{Line: s.Line - 1, Character: utf16Column(codeLines[s.Line-1], s.Column-1)},
+				End:   Position{Line: s.EndLine - 1, Character: utf16Column(codeLines[s.EndLine-1], s.EndColumn)},
+			},
+			Severity:    s.Severity,
+			Category:    s.Category,
+			Code:        ruleCode(s.Category, s.Rule, s.Message),
+			Message:     s.Message,
+			Explanation: strings.TrimSpace(s.Explanation),
+		}
+		if s.Replacement != nil {
+			// Without an original snippet the replacement covers the whole reported lines
+			suggestion.before = s.Original
+			if suggestion.before == "" {
+				suggestion.before = strings.Join(codeLines[s.Line-1:s.EndLine], "\n")
+			}
+			suggestion.after = *s.Replacement
+			suggestion.Diff = snippetDiff(suggestion.before, suggestion.after)
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	if len(problems) > 0 {
+		return suggestions, errors.New(strings.Join(problems, "; "))
+	}
+	return suggestions, nil
+}
+
+// ruleCode builds the category/rule identifier of a suggestion, deriving the rule from the message when the AI gave none
+func ruleCode(category, rule, message string) string {
+	slug := slugify(rule)
+	if slug == "" {
+		slug = slugify(message)
+	}
+	if slug == "" {
+		return category
+	}
+	return category + "/" + slug
+}
+
+// slugify lowercases s and joins its words with hyphens, keeping at most maxRuleLength characters
+func slugify(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if b.Len() >= maxRuleLength {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	return b.String()
+}
+
+// splitCodeLines splits code into its lines, without the empty element that follows a final newline
+func splitCodeLines(code string) []string {
+	lines := strings.Split(code, "\n")
+	if len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// firstNonBlank returns the offset of the first non-whitespace character of a line, or 0 for blank lines
+func firstNonBlank(line string) int {
+	trimmed := strings.TrimLeftFunc(line, unicode.IsSpace)
+	if trimmed == "" {
+		return 0
+	}
+	return utf8.RuneCountInString(line) - utf8.RuneCountInString(trimmed)
+}
+
+// lineLength counts the characters of a line, ignoring a trailing carriage return
+func lineLength(line string) int {
+	return utf8.RuneCountInString(strings.TrimSuffix(line, "\r"))
+}
+
+// utf16Column converts an offset of chars characters into line to UTF-16 code units
+func utf16Column(line string, chars int) int {
+	for i := range line {
+		if chars == 0 {
+			return utf16Len(line[:i])
+		}
+		chars--
+	}
+	return utf16Len(line)
+}
+
+// extractJSONObject strips Markdown code fences and any prose around the outermost JSON object
+func extractJSONObject(content string) string {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start == -1 || end < start {
+		return strings.TrimSpace(content)
+	}
+	return content[start : end+1]
+}
+
+// snippetDiff renders a replacement in the "- old\n+ new" form, used when it cannot be placed in the code
+func snippetDiff(before, after string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(before, "\n"), "\n") {
+		lines = append(lines, "- "+line)
+	}
+	if after != "" {
+		for _, line := range strings.Split(strings.TrimSuffix(after, "\n"), "\n") {
+			lines = append(lines, "+ "+line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
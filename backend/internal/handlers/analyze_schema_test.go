@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseStructuredAnalysisLineRange(t *testing.T) {
+	const code = "a = 1\nb = 2\nc = 3\n"
+	tests := []struct {
+		name      string
+		item      string
+		wantError string
+	}{
+		{"last line", `{"line": 3, "severity": "info", "category": "style", "message": "m"}`, ""},
+		{"line after the final newline", `{"line": 4, "severity": "info", "category": "style", "message": "m"}`, "line 4 is outside the code (1-3)"},
+		{"end line after the final newline", `{"line": 2, "end_line": 4, "severity": "info", "category": "style", "message": "m"}`, "end_line 4 must be between line 2 and 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suggestions, err := parseStructuredAnalysis(`{"suggestions": [`+tt.item+`]}`, code)
+			if tt.wantError == "" {
+				if err != nil || len(suggestions) != 1 {
+					t.Errorf("got %d suggestions and error %v, want one valid suggestion", len(suggestions), err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) || len(suggestions) != 0 {
+				t.Errorf("got %d suggestions and error %v, want %q", len(suggestions), err, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeHandler(t *testing.T) {
+	const closeFile = `{"line": 1, "severity": "warning", "category": "bug", "message": "Close the file"}`
+	const outsideCode = `{"line": 9, "severity": "info", "category": "style", "message": "Rename the variable"}`
+
+	tests := []struct {
+		name         string
+		config       string
+		wantStatus   int
+		wantMessages []string
+	}{
+		{
+			name:         "structured mock answer",
+			config:       `{"ai_provider": "mock", "ai_model": "mock", "mock": {"mode": "analyze"}, "prompts": {"beginner": "Review the code."}}`,
+			wantStatus:   200,
+			wantMessages: []string{"Add a descriptive comment", "Use a more descriptive name"},
+		},
+		{
+			name: "falls back when the primary provider fails",
+			config: `{"ai_provider": "mock", "ai_model": "failing", "mock": {"fail_every": 1},
+				"retry": {"max_attempts": 1}, "prompts": {"beginner": "Review the code."},
+				"fallbacks": [{"ai_provider": "mock", "ai_model": "backup", "mock": {"mode": "analyze"}}]}`,
+			wantStatus:   200,
+			wantMessages: []string{"Add a descriptive comment", "Use a more descriptive name"},
+		},
+		{
+			name: "times out with 504",
+			config: `{"ai_provider": "mock", "ai_model": "slow", "mock": {"mode": "analyze", "latency_ms": 3000},
+				"timeout_seconds": 1, "prompts": {"beginner": "Review the code."}}`,
+			wantStatus: 504,
+		},
+		{
+			name: "repairs an invalid reply",
+			config: `{"ai_provider": "mock", "ai_model": "mock", "prompts": {"beginner": "Review the code."},
+				"mock": {"responses": [
+					{"match": "did not match the required JSON format", "response": ` + quote(`{"suggestions": [`+closeFile+`]}`) + `},
+					{"match": "", "response": ` + quote(`{"suggestions": [`+outsideCode+`]}`) + `}]}}`,
+			wantStatus:   200,
+			wantMessages: []string{"Close the file"},
+		},
+		{
+			name: "keeps the valid suggestions when the repair fails",
+			config: `{"ai_provider": "mock", "ai_model": "mock", "prompts": {"beginner": "Review the code."},
+				"mock": {"responses": [{"match": "", "response": ` + quote(`{"suggestions": [`+closeFile+`, `+outsideCode+`]}`) + `}]}}`,
+			wantStatus:   200,
+			wantMessages: []string{"Close the file"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aiService, dbService, settingsService, fake := newTestServices(t, map[string]string{"analyze": tt.config})
+
+			w := postJSON(AnalyzeHandler(aiService, dbService, settingsService),
+				`{"code": "f = open('data.txt')\nprint(f.read())\n", "level": "beginner", "language": "python"}`)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+
+			var got AnalyzeResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("invalid response body: %v", err)
+			}
+			var messages []string
+			for _, s := range got.Suggestions {
+				messages = append(messages, s.Message)
+			}
+			if strings.Join(messages, "|") != strings.Join(tt.wantMessages, "|") {
+				t.Errorf("suggestions = %q, want %q", messages, tt.wantMessages)
+			}
+			if fake.executed("INSERT INTO queries") != 1 || fake.executed("INSERT INTO suggestions") != len(tt.wantMessages) {
+				t.Errorf("analysis and its %d suggestions were not stored", len(tt.wantMessages))
+			}
+		})
+	}
+}
+
+func TestAnalyzeHandlerUsesEditorContext(t *testing.T) {
+	aiService, dbService, settingsService, _ := newTestServices(t, map[string]string{
+		"analyze": `{"ai_provider": "mock", "ai_model": "mock", "mock": {"mode": "analyze"}, "prompts": {"beginner": "Review the code."}}`,
+	})
+
+	w := postJSON(AnalyzeHandler(aiService, dbService, settingsService),
+		`{"code": "x = 1\n", "level": "beginner", "context": {"language": "typescriptreact", "fileName": "App.tsx"}}`)
+	var got AnalyzeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != 200 {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+	if got.Language != "typescript" {
+		t.Errorf("language = %q, want typescript from the editor context", got.Language)
+	}
+}
+
+// quote encodes s as a JSON string
+func quote(s string) string {
+	encoded, _ := json.Marshal(s)
+	return string(encoded)
+}
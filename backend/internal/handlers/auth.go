@@ -12,6 +12,7 @@ import (
 
 	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/logger"
 	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/services"
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
@@ -350,3 +351,82 @@ func ProfileHandler(dbService *services.DBService) gin.HandlerFunc {
 		c.JSON(200, response)
 	}
 }
+
+// currentUserID returns the ID of the authenticated caller, or nil for anonymous requests
+func currentUserID(c *gin.Context) *int {
+	if id, ok := c.Get("user_id"); ok {
+		if userID, ok := id.(int); ok {
+			return &userID
+		}
+	}
+	return nil
+}
+
+// APITokenResponse defines the structure for a newly issued personal API token
+type APITokenResponse struct {
+	Token string `json:"token" example:"act_3f7a..."`
+}
+
+// CreateAPITokenHandler godoc
+// @Summary Issue a personal API token
+// @Description Create a personal API token for the IDE extension, replacing any previous token. The token is only shown once.
+// @Tags authentication
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 201 {object} APITokenResponse
+// @Failure 401 {object} map[string]string "Example: {'error': 'Unauthorized'}"
+// @Failure 500 {object} map[string]string "Example: {'error': 'Failed to create API token'}"
+// @Router /profile/api-token [post]
+func CreateAPITokenHandler(dbService *services.DBService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, exists := c.Get("username")
+		if !exists {
+			c.JSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		token, err := utils.GenerateAPIToken()
+		if err != nil {
+			logger.Log.Errorf("Failed to generate API token: %v", err)
+			c.JSON(500, gin.H{"error": "Failed to create API token"})
+			return
+		}
+		if err := dbService.SetUserAPIToken(username.(string), utils.HashAPIToken(token)); err != nil {
+			logger.Log.Errorf("Failed to store API token: %v", err)
+			c.JSON(500, gin.H{"error": "Failed to create API token"})
+			return
+		}
+
+		logger.Log.Infof("API token issued for user: %s", username)
+		c.JSON(201, APITokenResponse{Token: token})
+	}
+}
+
+// RevokeAPITokenHandler godoc
+// @Summary Revoke the personal API token
+// @Description Revoke the authenticated user's personal API token
+// @Tags authentication
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} map[string]string "Example: {'message': 'API token revoked'}"
+// @Failure 401 {object} map[string]string "Example: {'error': 'Unauthorized'}"
+// @Failure 500 {object} map[string]string "Example: {'error': 'Failed to revoke API token'}"
+// @Router /profile/api-token [delete]
+func RevokeAPITokenHandler(dbService *services.DBService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, exists := c.Get("username")
+		if !exists {
+			c.JSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		if err := dbService.RevokeUserAPIToken(username.(string)); err != nil {
+			logger.Log.Errorf("Failed to revoke API token: %v", err)
+			c.JSON(500, gin.H{"error": "Failed to revoke API token"})
+			return
+		}
+
+		logger.Log.Infof("API token revoked for user: %s", username)
+		c.JSON(200, gin.H{"message": "API token revoked"})
+	}
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/logger"
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/models"
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxConversationTurns bounds how many earlier queries of a thread are replayed to the AI
+const maxConversationTurns = 20
+
+// ConversationRequest defines the structure for creating or renaming a conversation
+// @Description Conversation title; an empty title on create is filled in from the first query
+type ConversationRequest struct {
+	Title string `json:"title" example:"Python file handling"`
+}
+
+// ConversationResponse represents a conversation thread
+// @Description Conversation thread
+type ConversationResponse struct {
+	ID        string `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Title     string `json:"title" example:"Python file handling"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// ConversationMessage is one query and answer of a conversation thread
+// @Description Query and AI answer within a conversation
+type ConversationMessage struct {
+	ID        string  `json:"id"`
+	Query     string  `json:"query"`
+	Response  string  `json:"response"`
+	Level     string  `json:"level"`
+	Feedback  *string `json:"feedback,omitempty"`
+	CreatedAt string  `json:"createdAt"`
+}
+
+// ConversationDetailResponse represents a conversation thread with its messages
+// @Description Conversation thread with its queries, oldest first
+type ConversationDetailResponse struct {
+	ConversationResponse
+	Messages []ConversationMessage `json:"messages"`
+}
+
+// @Summary Create a conversation
+// @Description Start a new conversation thread; pass its ID as conversation_id to /query to continue it. Requires signing in.
+// @Tags Conversations
+// @Accept json
+// @Produce json
+// @Param conversation body ConversationRequest false "Optional title"
+// @Success 201 {object} ConversationResponse
+// @Failure 400 {object} map[string]string "Invalid request format"
+// @Failure 401 {object} map[string]string "Not signed in"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/v1/conversations [post]
+func CreateConversationHandler(dbService *services.DBService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ConversationRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				logger.Log.Warnf("Invalid conversation request: %v", err)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+				return
+			}
+		}
+
+		// requireUser guarantees a signed-in caller
+		conv, err := dbService.CreateConversation(c.Request.Context(), *currentUserID(c), strings.TrimSpace(req.Title))
+		if err != nil {
+			logger.Log.Errorf("Failed to create conversation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create conversation"})
+			return
+		}
+		c.JSON(http.StatusCreated, newConversationResponse(conv))
+	}
+}
+
+// @Summary List conversations
+// @Description List the caller's conversation threads, most recently active first
+// @Tags Conversations
+// @Produce json
+// @Success 200 {array} ConversationResponse
+// @Failure 401 {object} map[string]string "Not signed in"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/v1/conversations [get]
+func ListConversationsHandler(dbService *services.DBService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conversations, err := dbService.ListConversations(c.Request.Context(), *currentUserID(c))
+		if err != nil {
+			logger.Log.Errorf("Failed to list conversations: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list conversations"})
+			return
+		}
+
+		response := make([]ConversationResponse, 0, len(conversations))
+		for i := range conversations {
+			response = append(response, newConversationResponse(&conversations[i]))
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// @Summary Get a conversation
+// @Description Get a conversation thread with all of its queries and answers
+// @Tags Conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} ConversationDetailResponse
+// @Failure 400 {object} map[string]string "Invalid conversation ID"
+// @Failure 401 {object} map[string]string "Not signed in"
+// @Failure 404 {object} map[string]string "Conversation not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/v1/conversations/{id} [get]
+func GetConversationHandler(dbService *services.DBService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := conversationIDParam(c)
+		if !ok {
+			return
+		}
+
+		conv, err := getOwnedConversation(c, dbService, id)
+		if err != nil {
+			respondConversationError(c, err, "Failed to get conversation")
+			return
+		}
+		queries, err := dbService.GetConversationQueries(c.Request.Context(), id, 0)
+		if err != nil {
+			logger.Log.Errorf("Failed to get conversation queries: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get conversation"})
+			return
+		}
+
+		response := ConversationDetailResponse{
+			ConversationResponse: newConversationResponse(conv),
+			Messages:             make([]ConversationMessage, 0, len(queries)),
+		}
+		for _, q := range queries {
+			response.Messages = append(response.Messages, ConversationMessage{
+				ID:        q.ID,
+				Query:     q.Query,
+				Response:  q.Response,
+				Level:     q.Level,
+				Feedback:  q.Feedback,
+				CreatedAt: q.CreatedAt.Format(time.RFC3339),
+			})
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// @Summary Rename a conversation
+// @Description Change the title of a conversation thread
+// @Tags Conversations
+// @Accept json
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Param conversation body ConversationRequest true "New title"
+// @Success 200 {object} map[string]string "Conversation renamed"
+// @Failure 400 {object} map[string]string "Invalid request format"
+// @Failure 401 {object} map[string]string "Not signed in"
+// @Failure 404 {object} map[string]string "Conversation not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/v1/conversations/{id} [patch]
+func RenameConversationHandler(dbService *services.DBService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := conversationIDParam(c)
+		if !ok {
+			return
+		}
+
+		var req ConversationRequest
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Title) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Title is required"})
+			return
+		}
+
+		if _, err := getOwnedConversation(c, dbService, id); err != nil {
+			respondConversationError(c, err, "Failed to rename conversation")
+			return
+		}
+		if err := dbService.RenameConversation(c.Request.Context(), id, strings.TrimSpace(req.Title)); err != nil {
+			respondConversationError(c, err, "Failed to rename conversation")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Conversation renamed successfully"})
+	}
+}
+
+// @Summary Delete a conversation
+// @Description Delete a conversation thread together with its queries
+// @Tags Conversations
+// @Produce json
+// @Param id path string true "Conversation ID"
+// @Success 200 {object} map[string]string "Conversation deleted"
+// @Failure 400 {object} map[string]string "Invalid conversation ID"
+// @Failure 401 {object} map[string]string "Not signed in"
+// @Failure 404 {object} map[string]string "Conversation not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/v1/conversations/{id} [delete]
+func DeleteConversationHandler(dbService *services.DBService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := conversationIDParam(c)
+		if !ok {
+			return
+		}
+
+		if _, err := getOwnedConversation(c, dbService, id); err != nil {
+			respondConversationError(c, err, "Failed to delete conversation")
+			return
+		}
+		if err := dbService.DeleteConversation(c.Request.Context(), id); err != nil {
+			respondConversationError(c, err, "Failed to delete conversation")
+			return
+		}
+		logger.Log.Infof("Conversation %s deleted", id)
+		c.JSON(http.StatusOK, gin.H{"message": "Conversation deleted successfully"})
+	}
+}
+
+// conversationIDParam validates the :id path parameter and responds with 400 when it is not a UUID
+func conversationIDParam(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return "", false
+	}
+	return id, true
+}
+
+// getOwnedConversation loads a conversation of the signed-in caller. Threads owned by another user, and
+// threads without an owner, are reported as not found so their existence is not revealed.
+func getOwnedConversation(c *gin.Context, dbService *services.DBService, id string) (*models.Conversation, error) {
+	userID := currentUserID(c)
+	if userID == nil {
+		return nil, services.ErrConversationNotFound
+	}
+	conv, err := dbService.GetConversation(c.Request.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if conv.UserID == nil || *conv.UserID != *userID {
+		return nil, services.ErrConversationNotFound
+	}
+	return conv, nil
+}
+
+// respondConversationError maps a missing conversation to 404 and other failures to 500
+func respondConversationError(c *gin.Context, err error, message string) {
+	if errors.Is(err, services.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	logger.Log.Errorf("%s: %v", message, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// newConversationResponse converts a conversation to its API representation
+func newConversationResponse(conv *models.Conversation) ConversationResponse {
+	return ConversationResponse{
+		ID:        conv.ID,
+		Title:     conv.Title,
+		CreatedAt: conv.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: conv.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// loadConversationHistory replays the latest queries of a thread as user/assistant turns
+func loadConversationHistory(c *gin.Context, dbService *services.DBService, conversationID string) ([]services.ChatMessage, error) {
+	if _, err := uuid.Parse(conversationID); err != nil {
+		return nil, services.ErrConversationNotFound
+	}
+	if _, err := getOwnedConversation(c, dbService, conversationID); err != nil {
+		return nil, err
+	}
+	queries, err := dbService.GetConversationQueries(c.Request.Context(), conversationID, maxConversationTurns)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]services.ChatMessage, 0, 2*len(queries))
+	for _, q := range queries {
+		history = append(history,
+			services.ChatMessage{Role: services.RoleUser, Content: q.Query},
+			services.ChatMessage{Role: services.RoleAssistant, Content: q.Response},
+		)
+	}
+	return history, nil
+}
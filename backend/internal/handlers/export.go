@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/logger"
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/models"
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// exportWriter renders exported queries in one output format
+type exportWriter interface {
+	begin(title string) error
+	writeQuery(q *models.Query) error
+	end() error
+}
+
+// exportFormats maps the format parameter to its file extension and content type
+var exportFormats = map[string]struct {
+	extension   string
+	contentType string
+}{
+	"markdown": {"md", "text/markdown; charset=utf-8"},
+	"json":     {"json", "application/json; charset=utf-8"},
+	"html":     {"html", "text/html; charset=utf-8"},
+}
+
+// newExportWriter returns the writer for a format listed in exportFormats
+func newExportWriter(format string, w io.Writer) exportWriter {
+	switch format {
+	case "json":
+		return &jsonExportWriter{w: w}
+	case "html":
+		return &htmlExportWriter{w: w}
+	default:
+		return &markdownExportWriter{w: w}
+	}
+}
+
+// @Summary Export history
+// @Description Download one query, one conversation thread or a date range of the caller's history as Markdown, JSON or standalone HTML.
+// @Description Pass exactly one of id or conversation_id, or neither to export by date range. Admins may export any query or thread,
+// @Description and another user's date range with user_id.
+// @Tags History
+// @Security ApiKeyAuth
+// @Produce text/markdown
+// @Produce json
+// @Produce text/html
+// @Param format query string false "Output format (default markdown)" Enums(markdown, json, html)
+// @Param id query string false "Export a single query"
+// @Param conversation_id query string false "Export a conversation thread"
+// @Param from query string false "Only queries at or after this time (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Only queries before this time (RFC 3339, or YYYY-MM-DD for the whole day)"
+// @Param user_id query int false "Export another user's history (admins only)"
+// @Success 200 {file} file "Export streamed as an attachment"
+// @Failure 400 {object} map[string]string "Invalid parameters"
+// @Failure 401 {object} map[string]string "Authentication required"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Failure 404 {object} map[string]string "Query or conversation not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/v1/history/export [get]
+func ExportHistoryHandler(dbService *services.DBService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := currentUserID(c)
+		if userID == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		format := c.DefaultQuery("format", "markdown")
+		output, ok := exportFormats[format]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format. Must be 'markdown', 'json' or 'html'"})
+			return
+		}
+
+		filter := services.ExportFilter{
+			QueryID:        c.Query("id"),
+			ConversationID: c.Query("conversation_id"),
+		}
+		var title, filename string
+		switch {
+		case filter.QueryID != "" && filter.ConversationID != "":
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Pass either id or conversation_id, not both"})
+			return
+
+		case filter.QueryID != "":
+			if _, err := uuid.Parse(filter.QueryID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query ID"})
+				return
+			}
+			query, err := dbService.GetQuery(c.Request.Context(), filter.QueryID)
+			if err == nil && !canReadQuery(c, query) {
+				err = services.ErrQueryNotFound
+			}
+			if err != nil {
+				if errors.Is(err, services.ErrQueryNotFound) {
+					c.JSON(http.StatusNotFound, gin.H{"error": "Query not found"})
+					return
+				}
+				logger.Log.Errorf("Failed to get query: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export history"})
+				return
+			}
+			title = "AI Coding Tutor " + query.Service
+			filename = "query-" + filter.QueryID[:8]
+
+		case filter.ConversationID != "":
+			if _, err := uuid.Parse(filter.ConversationID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+				return
+			}
+			var conv *models.Conversation
+			var err error
+			if isAdmin(c) {
+				conv, err = dbService.GetConversation(c.Request.Context(), filter.ConversationID)
+			} else {
+				conv, err = getOwnedConversation(c, dbService, filter.ConversationID)
+			}
+			if err != nil {
+				respondConversationError(c, err, "Failed to export history")
+				return
+			}
+			title = conv.Title
+			if title == "" {
+				title = "AI Coding Tutor conversation"
+			}
+			filename = "conversation-" + filter.ConversationID[:8]
+
+		default:
+			filter.UserID = userID
+			if value := c.Query("user_id"); value != "" {
+				if !isAdmin(c) {
+					c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+					return
+				}
+				otherID, err := strconv.Atoi(value)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+					return
+				}
+				filter.UserID = &otherID
+			}
+			if value := c.Query("from"); value != "" {
+				from, err := parseHistoryTime(value, false)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from parameter"})
+					return
+				}
+				filter.From = &from
+			}
+			if value := c.Query("to"); value != "" {
+				to, err := parseHistoryTime(value, true)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to parameter"})
+					return
+				}
+				filter.To = &to
+			}
+			title = "AI Coding Tutor history"
+			filename = "history-" + time.Now().Format("20060102")
+		}
+
+		c.Header("Content-Type", output.contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, output.extension))
+		c.Status(http.StatusOK)
+
+		// Rows are written as they are read so large ranges are not buffered
+		writer := newExportWriter(format, c.Writer)
+		err := writer.begin(title)
+		if err == nil {
+			err = dbService.ForEachQuery(c.Request.Context(), filter, func(q *models.Query) error {
+				if err := writer.writeQuery(q); err != nil {
+					return err
+				}
+				c.Writer.Flush()
+				return nil
+			})
+		}
+		if err == nil {
+			err = writer.end()
+		}
+		if err != nil {
+			// Headers are already sent, so the download is cut short
+			logger.Log.Errorf("Failed to export history: %v", err)
+		}
+	}
+}
+
+// markdownExportWriter renders queries as Markdown, keeping the code fences of the answers
+type markdownExportWriter struct {
+	w io.Writer
+}
+
+func (m *markdownExportWriter) begin(title string) error {
+	_, err := fmt.Fprintf(m.w, "# %s\n\nExported %s\n", title, time.Now().Format(time.RFC3339))
+	return err
+}
+
+func (m *markdownExportWriter) writeQuery(q *models.Query) error {
+	input := q.Query
+	heading := "Question"
+	if q.Service == "analyze" {
+		// Submitted code is raw source, not Markdown
+		heading = "Code"
+		input = fenceCode(input)
+	}
+	_, err := fmt.Fprintf(m.w, "\n---\n\n## %s (%s, %s level)\n\n%s\n\n### Answer\n\n%s\n",
+		heading, q.CreatedAt.Format(time.RFC3339), q.Level, input, q.Response)
+	return err
+}
+
+func (m *markdownExportWriter) end() error {
+	return nil
+}
+
+// fenceCode wraps code in a fence longer than any backtick run it contains
+func fenceCode(code string) string {
+	longest, run := 0, 0
+	for _, r := range code {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	return fence + "\n" + strings.TrimRight(code, "\n") + "\n" + fence
+}
+
+// jsonExportWriter renders queries as a single JSON document with an items array
+type jsonExportWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonExportWriter) begin(title string) error {
+	header, err := json.Marshal(gin.H{"title": title, "exported_at": time.Now().Format(time.RFC3339)})
+	if err != nil {
+		return err
+	}
+	// Reopen the header object to append the items array
+	_, err = fmt.Fprintf(j.w, "%s,\"items\":[", header[:len(header)-1])
+	return err
+}
+
+func (j *jsonExportWriter) writeQuery(q *models.Query) error {
+	item, err := json.Marshal(newHistoryItem(q))
+	if err != nil {
+		return err
+	}
+	if j.count > 0 {
+		if _, err := io.WriteString(j.w, ","); err != nil {
+			return err
+		}
+	}
+	j.count++
+	_, err = j.w.Write(item)
+	return err
+}
+
+func (j *jsonExportWriter) end() error {
+	_, err := io.WriteString(j.w, "]}\n")
+	return err
+}
+
+// htmlExportWriter renders queries as a standalone HTML page
+type htmlExportWriter struct {
+	w io.Writer
+}
+
+// exportHTMLStyle keeps the exported page readable without external assets
+const exportHTMLStyle = `body{font-family:system-ui,sans-serif;max-width:50rem;margin:2rem auto;padding:0 1rem;line-height:1.5;color:#1f2328}
+section{border-top:1px solid #d0d7de;padding-top:1rem;margin-top:1.5rem}
+.meta{color:#59636e;font-size:.875rem}
+.text{white-space:pre-wrap}
+pre{background:#f6f8fa;padding:.75rem;overflow-x:auto;border-radius:6px}`
+
+func (h *htmlExportWriter) begin(title string) error {
+	_, err := fmt.Fprintf(h.w, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n<h1>%s</h1>\n<p class=\"meta\">Exported %s</p>\n",
+		html.EscapeString(title), exportHTMLStyle, html.EscapeString(title), time.Now().Format(time.RFC3339))
+	return err
+}
+
+func (h *htmlExportWriter) writeQuery(q *models.Query) error {
+	input := q.Query
+	heading := "Question"
+	if q.Service == "analyze" {
+		heading = "Code"
+		input = fenceCode(input)
+	}
+	_, err := fmt.Fprintf(h.w, "<section>\n<h2>%s</h2>\n<p class=\"meta\">%s &middot; %s level</p>\n%s<h3>Answer</h3>\n%s</section>\n",
+		heading, q.CreatedAt.Format(time.RFC3339), html.EscapeString(q.Level), markdownToHTML(input), markdownToHTML(q.Response))
+	return err
+}
+
+func (h *htmlExportWriter) end() error {
+	_, err := io.WriteString(h.w, "</body>\n</html>\n")
+	return err
+}
+
+// markdownToHTML turns fenced code blocks into <pre><code> elements and keeps the rest as escaped, pre-wrapped text
+func markdownToHTML(markdown string) string {
+	var sb strings.Builder
+	var text, code []string
+	fence, language := "", ""
+
+	flushText := func() {
+		if content := strings.Trim(strings.Join(text, "\n"), "\n"); content != "" {
+			sb.WriteString("<div class=\"text\">" + html.EscapeString(content) + "</div>\n")
+		}
+		text = nil
+	}
+	for _, line := range strings.Split(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence == "" && strings.HasPrefix(trimmed, "```"):
+			flushText()
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, "`"))]
+			language = strings.TrimSpace(strings.TrimLeft(trimmed, "`"))
+		case fence != "" && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, "`") == "":
+			writeCodeBlock(&sb, language, code)
+			fence, code = "", nil
+		case fence != "":
+			code = append(code, line)
+		default:
+			text = append(text, line)
+		}
+	}
+	// An unterminated fence still renders as code
+	if fence != "" {
+		writeCodeBlock(&sb, language, code)
+	}
+	flushText()
+	return sb.String()
+}
+
+// writeCodeBlock renders one fenced code block
+func writeCodeBlock(sb *strings.Builder, language string, lines []string) {
+	class := ""
+	if language != "" {
+		class = ` class="language-` + html.EscapeString(language) + `"`
+	}
+	sb.WriteString("<pre><code" + class + ">" + html.EscapeString(strings.Join(lines, "\n")) + "</code></pre>\n")
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/logger"
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init("error")
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// fakeDB is an in-memory stand-in for Postgres that serves the settings table and records writes
+type fakeDB struct {
+	mu       sync.Mutex
+	settings map[string]string // Service name to config JSON
+	execs    []string
+	nextID   int64
+}
+
+// executed returns how many statements containing fragment were run
+func (db *fakeDB) executed(fragment string) int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	n := 0
+	for _, query := range db.execs {
+		if strings.Contains(query, fragment) {
+			n++
+		}
+	}
+	return n
+}
+
+// fakeDBs maps data source names to the fake databases opened through fakeDriver
+var fakeDBs sync.Map
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	db, ok := fakeDBs.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown fake database %q", name)
+	}
+	return &fakeConn{db: db.(*fakeDB)}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.execs = append(c.db.execs, query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	switch {
+	case strings.Contains(query, "SELECT DISTINCT service FROM settings"):
+		rows := &fakeRows{columns: []string{"service"}}
+		for _, service := range sortedKeys(c.db.settings) {
+			rows.values = append(rows.values, []driver.Value{service})
+		}
+		return rows, nil
+	case strings.Contains(query, "SELECT service, config FROM settings"):
+		rows := &fakeRows{columns: []string{"service", "config"}}
+		for _, service := range sortedKeys(c.db.settings) {
+			rows.values = append(rows.values, []driver.Value{service, c.db.settings[service]})
+		}
+		return rows, nil
+	case strings.Contains(query, "RETURNING id"):
+		c.db.execs = append(c.db.execs, query)
+		c.db.nextID++
+		return &fakeRows{columns: []string{"id"}, values: [][]driver.Value{{c.db.nextID}}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query: %s", query)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// newTestServices builds the services a handler needs on top of a fake database holding the given
+// service settings
+func newTestServices(t *testing.T, settings map[string]string) (*services.AIService, *services.DBService, *services.SettingsService, *fakeDB) {
+	t.Helper()
+	t.Setenv("ENCRYPTION_KEY", "0123456789abcdef0123456789abcdef")
+
+	fake := &fakeDB{settings: settings}
+	fakeDBs.Store(t.Name(), fake)
+	t.Cleanup(func() { fakeDBs.Delete(t.Name()) })
+	db, err := sql.Open("fakedb", t.Name())
+	if err != nil {
+		t.Fatalf("failed to open fake database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	dbService := services.NewDBServiceWithDB(db)
+	settingsService, err := services.NewSettingsService(dbService)
+	if err != nil {
+		t.Fatalf("failed to load settings: %v", err)
+	}
+	return services.NewAIService(settingsService), dbService, settingsService, fake
+}
+
+// postJSON sends body to handler and returns the recorded response
+func postJSON(handler gin.HandlerFunc, body string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.POST("/", handler)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
@@ -1,27 +1,52 @@
 package handlers
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/logger"
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/models"
 	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/services"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
+// maxFeedbackCommentLength bounds free-text feedback comments
+const maxFeedbackCommentLength = 2000
+
+// feedbackReasons lists the accepted reason tags
+var feedbackReasons = map[string]bool{
+	"wrong":        true,
+	"too_advanced": true,
+	"too_basic":    true,
+	"unclear":      true,
+	"incomplete":   true,
+	"off_topic":    true,
+}
+
 // FeedbackRequest defines the structure for user feedback
-// @Description Feedback request structure
+// @Description Feedback on an answer, or on one suggestion of an analysis when suggestion_id is set.
+// @Description At least one of feedback, rating or comment is required. A rating without a vote counts as positive (4-5), neutral (3) or negative (1-2).
 type FeedbackRequest struct {
-	QueryID  string `json:"id" binding:"required" example:"550e8400-e29b-41d4-a716-446655440000"`
-	Feedback string `json:"feedback" binding:"required" example:"positive" enums:"positive,negative,neutral"`
+	QueryID      string   `json:"id" binding:"required" example:"550e8400-e29b-41d4-a716-446655440000"`
+	SuggestionID *int     `json:"suggestion_id,omitempty" example:"42"`
+	Feedback     string   `json:"feedback,omitempty" example:"positive" enums:"positive,negative,neutral"`
+	Rating       *int     `json:"rating,omitempty" example:"4" minimum:"1" maximum:"5"`
+	Comment      string   `json:"comment,omitempty" example:"Clear explanation, but the example did not compile"`
+	Reasons      []string `json:"reasons,omitempty" example:"unclear" enums:"wrong,too_advanced,too_basic,unclear,incomplete,off_topic"`
 }
 
 // @Summary Submit feedback
-// @Description Submit feedback for an AI interaction
+// @Description Submit a vote, 1-5 rating, comment and reason tags for an AI answer or a single analysis suggestion.
+// @Description Signed-in users update their earlier feedback on the same answer or suggestion.
 // @Tags Feedback
 // @Accept json
 // @Produce json
 // @Param feedback body FeedbackRequest true "Feedback details"
-// @Success 200 {object} map[string]string "Feedback submitted successfully"
+// @Success 200 {object} map[string]interface{} "Feedback submitted successfully"
 // @Failure 400 {object} map[string]string "Invalid request format"
-// @Failure 404 {object} map[string]string "Query ID not found"
+// @Failure 404 {object} map[string]string "Query or suggestion not found"
+// @Failure 500 {object} map[string]string "Internal server error"
 // @Router /api/v1/feedback [post]
 func FeedbackHandler(dbService *services.DBService) gin.HandlerFunc {
 	logger.Log.Debugf("Initializing Feedback Handler")
@@ -32,17 +57,109 @@ func FeedbackHandler(dbService *services.DBService) gin.HandlerFunc {
 			c.JSON(400, gin.H{"error": "Invalid request"})
 			return
 		}
+		feedback, err := newFeedback(&req, currentUserID(c))
+		if err != nil {
+			logger.Log.Warnf("Invalid feedback request: %v", err)
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
 
 		logger.Log.Debugf("Processing feedback for query ID: %s", req.QueryID)
 
-		// Update feedback in database
-		if err := dbService.UpdateFeedback(req.QueryID, req.Feedback); err != nil {
-			logger.Log.Errorf("Failed to update feedback: %v", err)
-			c.JSON(500, gin.H{"error": "Failed to update feedback"})
+		// Unknown queries and queries owned by someone else are reported as not found
+		query, err := dbService.GetQuery(c.Request.Context(), req.QueryID)
+		if err == nil && !canRateQuery(c, query) {
+			err = services.ErrQueryNotFound
+		}
+		if err == nil {
+			err = dbService.SubmitFeedback(c.Request.Context(), feedback)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrQueryNotFound):
+				c.JSON(404, gin.H{"error": "Query not found"})
+			case errors.Is(err, services.ErrSuggestionNotFound):
+				c.JSON(404, gin.H{"error": "Suggestion not found"})
+			default:
+				logger.Log.Errorf("Failed to store feedback: %v", err)
+				c.JSON(500, gin.H{"error": "Failed to update feedback"})
+			}
 			return
 		}
 
-		logger.Log.Infof("Feedback received for query %s: %s", req.QueryID, req.Feedback)
-		c.JSON(200, gin.H{"status": "success"})
+		logger.Log.Infof("Feedback %d received for query %s", feedback.ID, req.QueryID)
+		c.JSON(200, gin.H{"status": "success", "id": feedback.ID})
+	}
+}
+
+// canRateQuery reports whether the caller may give feedback on a query: anyone for anonymous queries, only the owner otherwise
+func canRateQuery(c *gin.Context, query *models.Query) bool {
+	if query.UserID == nil {
+		return true
+	}
+	userID := currentUserID(c)
+	return userID != nil && *userID == *query.UserID
+}
+
+// newFeedback validates a feedback request and converts it to its database record
+func newFeedback(req *FeedbackRequest, userID *int) (*models.Feedback, error) {
+	if _, err := uuid.Parse(req.QueryID); err != nil {
+		return nil, errors.New("Invalid query ID")
+	}
+	feedback := &models.Feedback{
+		QueryID:      req.QueryID,
+		SuggestionID: req.SuggestionID,
+		UserID:       userID,
+		Rating:       req.Rating,
+	}
+
+	switch req.Feedback {
+	case "":
+	case "positive", "negative", "neutral":
+		feedback.Vote = &req.Feedback
+	default:
+		return nil, errors.New("Invalid feedback. Must be 'positive', 'negative' or 'neutral'")
+	}
+	if req.Rating != nil {
+		if *req.Rating < 1 || *req.Rating > 5 {
+			return nil, errors.New("Rating must be between 1 and 5")
+		}
+		if feedback.Vote == nil {
+			vote := ratingVote(*req.Rating)
+			feedback.Vote = &vote
+		}
+	}
+	if comment := strings.TrimSpace(req.Comment); comment != "" {
+		if len([]rune(comment)) > maxFeedbackCommentLength {
+			return nil, errors.New("Comment is too long")
+		}
+		feedback.Comment = &comment
+	}
+	if feedback.Vote == nil && feedback.Comment == nil {
+		return nil, errors.New("Feedback, rating or comment is required")
+	}
+
+	seen := make(map[string]bool)
+	for _, reason := range req.Reasons {
+		if !feedbackReasons[reason] {
+			return nil, errors.New("Invalid reason: " + reason)
+		}
+		if !seen[reason] {
+			seen[reason] = true
+			feedback.Reasons = append(feedback.Reasons, reason)
+		}
+	}
+	return feedback, nil
+}
+
+// ratingVote maps a 1-5 rating to a vote
+func ratingVote(rating int) string {
+	switch {
+	case rating >= 4:
+		return "positive"
+	case rating <= 2:
+		return "negative"
+	default:
+		return "neutral"
 	}
 }
@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/logger"
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/models"
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// HistoryItem represents a stored query and its AI answer
+// @Description Past query or code analysis with its AI answer
+type HistoryItem struct {
+	ID               string  `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	ConversationID   *string `json:"conversation_id,omitempty"`
+	Service          string  `json:"service" example:"query"`
+	Query            string  `json:"query" example:"How do I create a new file in Python?"`
+	Response         string  `json:"response"`
+	Provider         string  `json:"provider" example:"groq"`
+	Model            string  `json:"model" example:"llama-3.3-70b-versatile"`
+	Level            string  `json:"level" example:"novice"`
+	Feedback         *string `json:"feedback,omitempty" example:"positive"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	LatencyMs        int64   `json:"latency_ms"`
+	CreatedAt        string  `json:"createdAt"`
+}
+
+// HistoryResponse is a page of the caller's history
+// @Description Page of past queries, newest first
+type HistoryResponse struct {
+	Items      []HistoryItem `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"` // Pass as cursor to fetch the next page; omitted on the last page
+}
+
+// @Summary List query history
+// @Description List the authenticated user's past queries and analyses, newest first, with cursor pagination
+// @Tags History
+// @Security ApiKeyAuth
+// @Produce json
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param service query string false "Filter by service, e.g. query or analyze"
+// @Param level query string false "Filter by level" Enums(novice, medium, expert)
+// @Param provider query string false "Filter by AI provider"
+// @Param feedback query string false "Filter by feedback; none selects queries without feedback" Enums(positive, negative, neutral, none)
+// @Param from query string false "Only queries at or after this time (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Only queries before this time (RFC 3339, or YYYY-MM-DD for the whole day)"
+// @Success 200 {object} HistoryResponse
+// @Failure 400 {object} map[string]string "Invalid filter or cursor"
+// @Failure 401 {object} map[string]string "Authentication required"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/v1/history [get]
+func ListHistoryHandler(dbService *services.DBService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := currentUserID(c)
+		if userID == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		filter, err := parseHistoryFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter.UserID = *userID
+
+		// Fetch one extra row to know whether there is a next page
+		limit := filter.Limit
+		filter.Limit++
+		queries, err := dbService.ListQueries(c.Request.Context(), filter)
+		if err != nil {
+			logger.Log.Errorf("Failed to list history: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list history"})
+			return
+		}
+
+		response := HistoryResponse{Items: make([]HistoryItem, 0, limit)}
+		if len(queries) > limit {
+			queries = queries[:limit]
+			last := queries[limit-1]
+			response.NextCursor = encodeHistoryCursor(services.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		}
+		for i := range queries {
+			response.Items = append(response.Items, newHistoryItem(&queries[i]))
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// @Summary Get a past query
+// @Description Get one of the authenticated user's past queries or analyses; admins may read any
+// @Tags History
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "Query ID"
+// @Success 200 {object} HistoryItem
+// @Failure 400 {object} map[string]string "Invalid query ID"
+// @Failure 401 {object} map[string]string "Authentication required"
+// @Failure 404 {object} map[string]string "Query not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/v1/history/{id} [get]
+func GetHistoryItemHandler(dbService *services.DBService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if _, err := uuid.Parse(id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query ID"})
+			return
+		}
+
+		query, err := dbService.GetQuery(c.Request.Context(), id)
+		if err != nil {
+			if errors.Is(err, services.ErrQueryNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Query not found"})
+				return
+			}
+			logger.Log.Errorf("Failed to get query: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get query"})
+			return
+		}
+		if !canReadQuery(c, query) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Query not found"})
+			return
+		}
+		c.JSON(http.StatusOK, newHistoryItem(query))
+	}
+}
+
+// SearchResultItem is a past query matched by a search
+// @Description Past query matched by a full-text search, with highlighted snippets
+type SearchResultItem struct {
+	HistoryItem
+	UserID          *int    `json:"user_id,omitempty"` // Only set for admin searches across all users
+	Rank            float64 `json:"rank"`
+	QuerySnippet    string  `json:"query_snippet"`    // Matching part of the query, terms wrapped in <mark></mark>
+	ResponseSnippet string  `json:"response_snippet"` // Matching part of the answer, terms wrapped in <mark></mark>
+}
+
+// SearchResponse is a page of search results
+// @Description Page of search results, best match first
+type SearchResponse struct {
+	Results    []SearchResultItem `json:"results"`
+	NextOffset *int               `json:"next_offset,omitempty"` // Pass as offset to fetch the next page; omitted on the last page
+}
+
+// @Summary Search query history
+// @Description Full-text search over the authenticated user's past questions and answers, best match first.
+// @Description Supports web-search syntax ("quoted phrases", or, -excluded). Admins can pass all=true to search every user's history.
+// @Description Snippets are HTML-escaped, with matches wrapped in <mark></mark>.
+// @Tags History
+// @Security ApiKeyAuth
+// @Produce json
+// @Param q query string true "Search terms"
+// @Param service query string false "Filter by service, e.g. query or analyze"
+// @Param all query bool false "Search all users (admins only)"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param offset query int false "Number of results to skip"
+// @Success 200 {object} SearchResponse
+// @Failure 400 {object} map[string]string "Missing search terms or invalid parameters"
+// @Failure 401 {object} map[string]string "Authentication required"
+// @Failure 403 {object} map[string]string "Admin access required"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/v1/history/search [get]
+func SearchHistoryHandler(dbService *services.DBService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := currentUserID(c)
+		if userID == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		filter := services.SearchFilter{
+			Text:    strings.TrimSpace(c.Query("q")),
+			UserID:  userID,
+			Service: c.Query("service"),
+			Limit:   defaultHistoryLimit,
+		}
+		if filter.Text == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Search terms are required"})
+			return
+		}
+		if c.Query("all") == "true" {
+			if !isAdmin(c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+				return
+			}
+			filter.UserID = nil
+		}
+		if value := c.Query("limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+				return
+			}
+			filter.Limit = min(limit, maxHistoryLimit)
+		}
+		if value := c.Query("offset"); value != "" {
+			offset, err := strconv.Atoi(value)
+			if err != nil || offset < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset parameter"})
+				return
+			}
+			filter.Offset = offset
+		}
+
+		// Fetch one extra row to know whether there is a next page
+		limit := filter.Limit
+		filter.Limit++
+		results, err := dbService.SearchQueries(c.Request.Context(), filter)
+		if err != nil {
+			logger.Log.Errorf("Failed to search history: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search history"})
+			return
+		}
+
+		response := SearchResponse{Results: make([]SearchResultItem, 0, limit)}
+		if len(results) > limit {
+			results = results[:limit]
+			next := filter.Offset + limit
+			response.NextOffset = &next
+		}
+		for i := range results {
+			item := SearchResultItem{
+				HistoryItem:     newHistoryItem(&results[i].Query),
+				Rank:            results[i].Rank,
+				QuerySnippet:    results[i].QuerySnippet,
+				ResponseSnippet: results[i].ResponseSnippet,
+			}
+			if filter.UserID == nil {
+				item.UserID = results[i].UserID
+			}
+			response.Results = append(response.Results, item)
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// isAdmin reports whether the caller has an admin or superadmin role
+func isAdmin(c *gin.Context) bool {
+	role := c.GetString("role")
+	return role == "admin" || role == "superadmin"
+}
+
+// canReadQuery reports whether the caller owns a stored query or is an admin
+func canReadQuery(c *gin.Context, query *models.Query) bool {
+	if isAdmin(c) {
+		return true
+	}
+	userID := currentUserID(c)
+	return userID != nil && query.UserID != nil && *userID == *query.UserID
+}
+
+// parseHistoryFilter reads the pagination and filter parameters of a history request
+func parseHistoryFilter(c *gin.Context) (services.HistoryFilter, error) {
+	filter := services.HistoryFilter{
+		Service:  c.Query("service"),
+		Level:    c.Query("level"),
+		Provider: c.Query("provider"),
+		Feedback: c.Query("feedback"),
+		Limit:    defaultHistoryLimit,
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return filter, errors.New("Invalid limit parameter")
+		}
+		filter.Limit = min(limit, maxHistoryLimit)
+	}
+	switch filter.Feedback {
+	case "", "positive", "negative", "neutral", "none":
+	default:
+		return filter, errors.New("Invalid feedback parameter")
+	}
+	if value := c.Query("from"); value != "" {
+		from, err := parseHistoryTime(value, false)
+		if err != nil {
+			return filter, errors.New("Invalid from parameter")
+		}
+		filter.From = &from
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := parseHistoryTime(value, true)
+		if err != nil {
+			return filter, errors.New("Invalid to parameter")
+		}
+		filter.To = &to
+	}
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeHistoryCursor(value)
+		if err != nil {
+			return filter, errors.New("Invalid cursor")
+		}
+		filter.Cursor = &cursor
+	}
+	return filter, nil
+}
+
+// parseHistoryTime accepts RFC 3339 timestamps and plain dates. A plain date used as an
+// exclusive upper bound is moved to the following midnight so the whole day is included.
+// Timestamps are converted to UTC, in which created_at is stored, as the column has no time zone.
+func parseHistoryTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// encodeHistoryCursor turns the position of a query into an opaque page cursor
+func encodeHistoryCursor(cursor services.HistoryCursor) string {
+	raw := cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + cursor.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeHistoryCursor parses a cursor created by encodeHistoryCursor
+func decodeHistoryCursor(value string) (services.HistoryCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return services.HistoryCursor{}, err
+	}
+	createdAt, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return services.HistoryCursor{}, errors.New("malformed cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return services.HistoryCursor{}, err
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return services.HistoryCursor{}, err
+	}
+	return services.HistoryCursor{CreatedAt: t.UTC(), ID: id}, nil
+}
+
+// newHistoryItem converts a stored query to its API representation
+func newHistoryItem(q *models.Query) HistoryItem {
+	return HistoryItem{
+		ID:               q.ID,
+		ConversationID:   q.ConversationID,
+		Service:          q.Service,
+		Query:            q.Query,
+		Response:         q.Response,
+		Provider:         q.Provider,
+		Model:            q.Model,
+		Level:            q.Level,
+		Feedback:         q.Feedback,
+		PromptTokens:     q.PromptTokens,
+		CompletionTokens: q.CompletionTokens,
+		TotalTokens:      q.TotalTokens,
+		LatencyMs:        q.LatencyMs,
+		CreatedAt:        q.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseHistoryTime(t *testing.T) {
+	tests := []struct {
+		value    string
+		endOfDay bool
+		want     time.Time
+	}{
+		{"2026-03-01T10:00:00+02:00", false, time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)},
+		{"2026-03-01T10:00:00Z", true, time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)},
+		{"2026-03-01", false, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"2026-03-01", true, time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseHistoryTime(tt.value, tt.endOfDay)
+		if err != nil {
+			t.Fatalf("parseHistoryTime(%q): %v", tt.value, err)
+		}
+		if got.Location() != time.UTC || !got.Equal(tt.want) {
+			t.Errorf("parseHistoryTime(%q, %v) = %v, want %v", tt.value, tt.endOfDay, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"path"
+	"strings"
+
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// resolveLanguage returns the language given by the caller, or detects it from the filename and code
+// when none was given. It responds with 400 and returns false when the given language is malformed.
+func resolveLanguage(c *gin.Context, language, filename, code string) (string, bool) {
+	if language == "" {
+		return utils.DetectLanguage(filename, code), true
+	}
+	normalized, ok := utils.NormalizeLanguage(language)
+	if !ok {
+		c.JSON(400, gin.H{"error": "Invalid language"})
+		return "", false
+	}
+	return normalized, true
+}
+
+// queryLanguageHints collects what a query tells about its language: the explicit fields, then the
+// editor context sent by the IDE plugin, then the first Markdown code block of the query
+func queryLanguageHints(req *QueryRequest) (language, filename, code string) {
+	language, filename, code = editorHints(req.Context, req.Language, req.Filename)
+	if info, fenced, ok := firstCodeBlock(req.Query); ok {
+		if fields := strings.Fields(info); language == "" && len(fields) > 0 {
+			language = languageHint(fields[0])
+		}
+		code = fenced
+	}
+	return language, filename, code
+}
+
+// editorHints fills in the language and filename the caller left empty from the editor context sent by
+// the IDE plugin, and returns the file content the context carries
+func editorHints(context interface{}, language, filename string) (string, string, string) {
+	editor, ok := context.(map[string]interface{})
+	if !ok {
+		return language, filename, ""
+	}
+	if language == "" {
+		language = languageHint(editor["language"])
+	}
+	if filename == "" {
+		filename, _ = editor["fileName"].(string)
+	}
+	code, _ := editor["fileContent"].(string)
+	return language, filename, code
+}
+
+// languageHint normalizes a language found in context, dropping values that are not language IDs
+func languageHint(value interface{}) string {
+	hint, _ := value.(string)
+	if language, ok := utils.NormalizeLanguage(hint); ok {
+		return language
+	}
+	return ""
+}
+
+// firstCodeBlock returns the info string and content of the first fenced code block in Markdown text
+func firstCodeBlock(text string) (info, code string, ok bool) {
+	_, rest, found := strings.Cut(text, "```")
+	if !found {
+		return "", "", false
+	}
+	info, rest, _ = strings.Cut(rest, "\n")
+	code, _, _ = strings.Cut(rest, "```")
+	return strings.TrimSpace(info), code, true
+}
+
+// languagePrompt tells the model which language the code is in, so it does not have to guess
+func languagePrompt(prompt, language string) string {
+	if language == "" {
+		return prompt
+	}
+	return prompt + "\n\nThe student's code is written in " + utils.LanguageName(language) + "."
+}
+
+// diffName returns the name used in diff headers: the base name of the submitted file, or "code"
+func diffName(filename string) string {
+	name := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if filename == "" || name == "." || name == "/" || strings.ContainsAny(name, "\r\n\t") {
+		return diffFileName
+	}
+	return name
+}
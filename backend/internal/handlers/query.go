@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"strings"
 
 	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/logger"
@@ -17,6 +19,11 @@ type QueryRequest struct {
 	Query   string      `json:"query" binding:"required" example:"How do I create a new file in Python?"`
 	Level   string      `json:"level" binding:"required" example:"beginner" enums:"beginner,intermediate,advanced"`
 	Context interface{} `json:"context,omitempty"`
+	// Continue a stored conversation of the signed-in user; its earlier turns are loaded from the database instead of the context
+	ConversationID string `json:"conversation_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"`
+	// Language ID as used by VS Code; taken from the editor context or detected when omitted
+	Language string `json:"language,omitempty" example:"python"`
+	Filename string `json:"filename,omitempty" example:"hello.py"`
 }
 
 // QueryResponse defines the structure for AI query responses
@@ -24,6 +31,11 @@ type QueryRequest struct {
 type QueryResponse struct {
 	ID       string `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
 	Response string `json:"response" example:"To create a new file in Python, you can use the open() function with 'w' mode..."`
+	Cached   bool   `json:"cached" example:"false"`
+	// Conversation the query was stored in, omitted for one-off queries
+	ConversationID string `json:"conversation_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"`
+	// Given or detected language of the code the query is about, omitted when unknown
+	Language string `json:"language,omitempty" example:"python"`
 }
 
 // @Summary Query the AI
@@ -34,7 +46,9 @@ type QueryResponse struct {
 // @Param query body QueryRequest true "Query parameters"
 // @Success 200 {object} QueryResponse
 // @Failure 400 {object} map[string]string "Invalid request format"
+// @Failure 404 {object} map[string]string "Conversation not found"
 // @Failure 500 {object} map[string]string "Internal server error"
+// @Failure 504 {object} map[string]string "AI provider timed out"
 // @Router /api/v1/query [post]
 func QueryHandler(aiService *services.AIService, dbService *services.DBService, settingsService *services.SettingsService) gin.HandlerFunc {
 	logger.Log.Debugf("QueryHandler: aiService=%v, dbService=%v", aiService, dbService)
@@ -56,16 +70,239 @@ func QueryHandler(aiService *services.AIService, dbService *services.DBService,
 			c.JSON(500, gin.H{"error": "Failed to get settings"})
 			return
 		}
-		promptTemplate, ok := ai_settings.Prompts[req.Level]
+		hint, filename, code := queryLanguageHints(&req)
+		language, ok := resolveLanguage(c, hint, filename, code)
+		if !ok {
+			return
+		}
+		promptTemplate, ok := ai_settings.Prompts.Prompt(language, req.Level)
+		if !ok {
+			logger.Log.Warnf("Invalid level: %s", req.Level)
+			c.JSON(400, gin.H{"error": "Invalid level"})
+			return
+		}
+		history, ok := queryHistory(c, dbService, &req)
+		if !ok {
+			return
+		}
+		messages := buildQueryMessages(languagePrompt(promptTemplate, language), history, &req)
+
+		// Get AI response
+		response, err := aiService.GetResponse(c.Request.Context(), "query", ai_settings.AIProvider, ai_settings.AIModel, messages)
+		if err != nil {
+			respondAIError(c, err)
+			return
+		}
+
+		logger.Log.Infof("Response received from %s: %s", response.Provider, strings.Split(response.Content, "\n")[0])
+
+		// Store in database
+		query := newQueryRecord(id, "query", req.Query, req.Level, currentUserID(c), response)
+		query.PromptVersion = services.PromptVersion(promptTemplate)
+		if req.ConversationID != "" {
+			query.ConversationID = &req.ConversationID
+		}
+		if err := dbService.CreateQuery(c.Request.Context(), query); err != nil {
+			logger.Log.Errorf("Failed to store query: %v", err)
+			c.JSON(500, gin.H{"error": "Failed to store query"})
+			return
+		}
+
+		// Respond to client
+		c.JSON(200, gin.H{
+			"id":              id,
+			"response":        response.Content,
+			"cached":          response.Cached,
+			"conversation_id": req.ConversationID,
+			"language":        language,
+		})
+	}
+}
+
+// @Summary Query the AI with a streamed response
+// @Description Send a query to the AI and receive the response as Server-Sent Events.
+// @Description Emits "delta" events with partial content, then a final "done" event with the query ID and full response, or an "error" event.
+// @Description Failures before the first delta are answered with a JSON error and status code instead of a stream.
+// @Tags AI Interaction
+// @Accept json
+// @Produce text/event-stream
+// @Param query body QueryRequest true "Query parameters"
+// @Success 200 {string} string "SSE stream of delta/done/error events"
+// @Failure 400 {object} map[string]string "Invalid request format"
+// @Failure 404 {object} map[string]string "Conversation not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Failure 503 {object} map[string]string "AI provider temporarily unavailable"
+// @Failure 504 {object} map[string]string "AI provider timed out"
+// @Router /api/v1/query/stream [post]
+func QueryStreamHandler(aiService *services.AIService, dbService *services.DBService, settingsService *services.SettingsService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req QueryRequest
+		if err := c.BindJSON(&req); err != nil {
+			logger.Log.Warnf("Invalid request: %v", err)
+			c.JSON(400, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		id := uuid.New().String()
+
+		ai_settings, err := settingsService.GetAiSettings("query")
+		if err != nil {
+			logger.Log.Errorf("Failed to get settings: %v", err)
+			c.JSON(500, gin.H{"error": "Failed to get settings"})
+			return
+		}
+		hint, filename, code := queryLanguageHints(&req)
+		language, ok := resolveLanguage(c, hint, filename, code)
+		if !ok {
+			return
+		}
+		promptTemplate, ok := ai_settings.Prompts.Prompt(language, req.Level)
 		if !ok {
 			logger.Log.Warnf("Invalid level: %s", req.Level)
 			c.JSON(400, gin.H{"error": "Invalid level"})
 			return
 		}
-		prompt := promptTemplate
+		history, ok := queryHistory(c, dbService, &req)
+		if !ok {
+			return
+		}
+		messages := buildQueryMessages(languagePrompt(promptTemplate, language), history, &req)
+
+		// Relay each token delta to the client as it arrives. The stream only starts with the first
+		// delta, so earlier failures still get a status code like non-streamed queries.
+		started := false
+		response, err := aiService.StreamResponse(c.Request.Context(), "query", ai_settings.AIProvider, ai_settings.AIModel, messages, func(delta string) error {
+			if !started {
+				startEventStream(c)
+				started = true
+			}
+			c.SSEvent("delta", gin.H{"content": delta})
+			c.Writer.Flush()
+			return nil
+		})
+		if err != nil && !started {
+			respondAIError(c, err)
+			return
+		}
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				logger.Log.Infof("Client closed the stream before the AI response completed")
+				return
+			}
+			logger.Log.Errorf("Failed to stream AI response: %v", err)
+			errMsg := "Failed to get AI response"
+			if errors.Is(err, context.DeadlineExceeded) {
+				errMsg = "AI provider timed out"
+			}
+			c.SSEvent("error", gin.H{"error": errMsg})
+			c.Writer.Flush()
+			return
+		}
+
+		logger.Log.Infof("Streamed response completed by %s: %s", response.Provider, strings.Split(response.Content, "\n")[0])
+		if !started {
+			startEventStream(c)
+		}
+
+		// Store the final text in database
+		query := newQueryRecord(id, "query", req.Query, req.Level, currentUserID(c), response)
+		query.PromptVersion = services.PromptVersion(promptTemplate)
+		if req.ConversationID != "" {
+			query.ConversationID = &req.ConversationID
+		}
+		if err := dbService.CreateQuery(c.Request.Context(), query); err != nil {
+			logger.Log.Errorf("Failed to store query: %v", err)
+			c.SSEvent("error", gin.H{"error": "Failed to store query"})
+			c.Writer.Flush()
+			return
+		}
+
+		c.SSEvent("done", gin.H{
+			"id":              id,
+			"response":        response.Content,
+			"cached":          response.Cached,
+			"conversation_id": req.ConversationID,
+			"language":        language,
+		})
+		c.Writer.Flush()
+	}
+}
+
+// startEventStream sets the headers of a Server-Sent Events response
+func startEventStream(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+}
+
+// newQueryRecord builds the database row for an AI call, including its owner, token usage and latency
+func newQueryRecord(id, service, input, level string, userID *int, response *services.AIResponse) *models.Query {
+	return &models.Query{
+		ID:               id,
+		UserID:           userID,
+		Service:          service,
+		Query:            input,
+		Provider:         response.Provider,
+		Model:            response.Model,
+		Level:            level,
+		Response:         response.Content,
+		Feedback:         nil,
+		PromptTokens:     response.Usage.PromptTokens,
+		CompletionTokens: response.Usage.CompletionTokens,
+		TotalTokens:      response.Usage.TotalTokens,
+		LatencyMs:        response.Latency.Milliseconds(),
+	}
+}
 
-		// Handle context which can now be a string or an object
-		if req.Context != nil {
+// respondAIError maps AI call failures to HTTP responses: 504 when the service timeout passed,
+// 503 when every provider's circuit is open, nothing when the client went away, and 500 otherwise
+func respondAIError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		logger.Log.Errorf("AI response timed out: %v", err)
+		c.JSON(504, gin.H{"error": "AI provider timed out"})
+	case errors.Is(err, services.ErrCircuitOpen):
+		logger.Log.Errorf("No AI provider available: %v", err)
+		c.JSON(503, gin.H{"error": "AI provider temporarily unavailable"})
+	case errors.Is(err, context.Canceled):
+		logger.Log.Infof("Client cancelled the request before the AI response arrived")
+		c.Abort()
+	default:
+		logger.Log.Errorf("Failed to get AI response: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to get AI response"})
+	}
+}
+
+// queryHistory loads the earlier turns of the request's conversation, responding with 404 when it does not exist
+func queryHistory(c *gin.Context, dbService *services.DBService, req *QueryRequest) ([]services.ChatMessage, bool) {
+	if req.ConversationID == "" {
+		return nil, true
+	}
+	history, err := loadConversationHistory(c, dbService, req.ConversationID)
+	if err != nil {
+		respondConversationError(c, err, "Failed to load conversation")
+		return nil, false
+	}
+	return history, true
+}
+
+// buildQueryMessages keeps the level prompt in the system role and the student's input in user turns,
+// so the query cannot override the tutor instructions. Stored conversation history takes the place of
+// turns passed in the context.
+func buildQueryMessages(promptTemplate string, history []services.ChatMessage, req *QueryRequest) []services.ChatMessage {
+	messages := []services.ChatMessage{{Role: services.RoleSystem, Content: promptTemplate}}
+	messages = append(messages, history...)
+	query := req.Query
+
+	// Handle context which can be a list of turns, a transcript string or an object
+	if req.Context != nil {
+		turns := parseContextTurns(req.Context)
+		if len(turns) > 0 {
+			if req.ConversationID == "" {
+				messages = append(messages, turns...)
+			}
+		} else {
 			contextStr := ""
 			switch v := req.Context.(type) {
 			case string:
@@ -80,41 +317,45 @@ func QueryHandler(aiService *services.AIService, dbService *services.DBService,
 				}
 			}
 
-			if contextStr != "" {
-				prompt += "\nPrevious conversation:\n" + contextStr + "\n\nCurrent query: "
+			if contextStr != "" && contextStr != "{}" {
+				query = "Context:\n" + contextStr + "\n\nCurrent query: " + query
 			}
 		}
-		prompt += req.Query
+	}
+	return append(messages, services.ChatMessage{Role: services.RoleUser, Content: query})
+}
 
-		// Get AI response
-		response, err := aiService.GetResponse("query", ai_settings.AIProvider, ai_settings.AIModel, prompt)
-		if err != nil {
-			logger.Log.Errorf("Failed to get AI response: %v", err)
-			c.JSON(500, gin.H{"error": "Failed to get AI response"})
-			return
+// parseContextTurns extracts prior user/assistant turns from a context given either as
+// a list of {role, content} objects or as a "role: content" transcript
+func parseContextTurns(context interface{}) []services.ChatMessage {
+	var turns []services.ChatMessage
+	switch v := context.(type) {
+	case []interface{}:
+		for _, item := range v {
+			entry, ok := item.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			role, _ := entry["role"].(string)
+			content, _ := entry["content"].(string)
+			if (role != services.RoleUser && role != services.RoleAssistant) || content == "" {
+				return nil
+			}
+			turns = append(turns, services.ChatMessage{Role: role, Content: content})
 		}
-
-		logger.Log.Infof("Response received: %s", strings.Split(response, "\n")[0])
-
-		// Store in database
-		query := &models.Query{
-			ID:       id,
-			Query:    req.Query,
-			Provider: ai_settings.AIProvider,
-			Level:    req.Level,
-			Response: response,
-			Feedback: nil,
-		}
-		if err := dbService.CreateQuery(query); err != nil {
-			logger.Log.Errorf("Failed to store query: %v", err)
-			c.JSON(500, gin.H{"error": "Failed to store query"})
-			return
+	case string:
+		for _, line := range strings.Split(v, "\n") {
+			role, content, found := strings.Cut(line, ": ")
+			if found && (role == services.RoleUser || role == services.RoleAssistant) {
+				turns = append(turns, services.ChatMessage{Role: role, Content: content})
+				continue
+			}
+			// Continuation of a multi-line message
+			if len(turns) == 0 {
+				return nil
+			}
+			turns[len(turns)-1].Content += "\n" + line
 		}
-
-		// Respond to client
-		c.JSON(200, gin.H{
-			"id":       id,
-			"response": response,
-		})
 	}
+	return turns
 }
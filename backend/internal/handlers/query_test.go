@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestQueryHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		wantStatus   int
+		wantResponse string
+	}{
+		{
+			name:         "mock answers",
+			config:       `{"ai_provider": "mock", "ai_model": "mock", "prompts": {"beginner": "You are a tutor."}}`,
+			wantStatus:   200,
+			wantResponse: "Mock response: How do I read a file?",
+		},
+		{
+			name: "falls back when the primary provider fails",
+			config: `{"ai_provider": "mock", "ai_model": "failing", "mock": {"fail_every": 1},
+				"retry": {"max_attempts": 1}, "prompts": {"beginner": "You are a tutor."},
+				"fallbacks": [{"ai_provider": "mock", "ai_model": "backup",
+					"mock": {"responses": [{"match": "", "response": "Answer from the fallback"}]}}]}`,
+			wantStatus:   200,
+			wantResponse: "Answer from the fallback",
+		},
+		{
+			name: "times out with 504",
+			config: `{"ai_provider": "mock", "ai_model": "slow", "mock": {"latency_ms": 3000},
+				"timeout_seconds": 1, "prompts": {"beginner": "You are a tutor."}}`,
+			wantStatus: 504,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aiService, dbService, settingsService, fake := newTestServices(t, map[string]string{"query": tt.config})
+
+			w := postJSON(QueryHandler(aiService, dbService, settingsService),
+				`{"query": "How do I read a file?", "level": "beginner"}`)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != 200 {
+				if fake.executed("INSERT INTO queries") != 0 {
+					t.Errorf("failed query was stored")
+				}
+				return
+			}
+
+			var got QueryResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("invalid response body: %v", err)
+			}
+			if got.Response != tt.wantResponse {
+				t.Errorf("response = %q, want %q", got.Response, tt.wantResponse)
+			}
+			if got.ID == "" || fake.executed("INSERT INTO queries") != 1 {
+				t.Errorf("query was not stored under its ID %q", got.ID)
+			}
+		})
+	}
+}
+
+func TestQueryHandlerRejectsUnknownLevel(t *testing.T) {
+	aiService, dbService, settingsService, _ := newTestServices(t, map[string]string{
+		"query": `{"ai_provider": "mock", "ai_model": "mock", "prompts": {"beginner": "You are a tutor."}}`,
+	})
+
+	w := postJSON(QueryHandler(aiService, dbService, settingsService), `{"query": "Hi", "level": "expert"}`)
+	if w.Code != 400 || !strings.Contains(w.Body.String(), "Invalid level") {
+		t.Errorf("got %d %s, want 400 Invalid level", w.Code, w.Body.String())
+	}
+}
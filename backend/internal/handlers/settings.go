@@ -2,6 +2,9 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/logger"
 	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/services"
@@ -30,22 +33,54 @@ type ServiceConfig struct {
 		APIKey string `json:"api_key"`
 		// AI model temperature
 		Temperature *float64 `json:"temperature,omitempty"`
-		// named prompts
-		Prompts map[string]string `json:"prompts"`
+		// prompts by level; an object value holds the level prompts of one language, e.g. "go": {"novice": "..."}
+		Prompts map[string]interface{} `json:"prompts"`
 		// API endpoint URL for the provider
 		APIURL string `json:"api_url,omitempty"`
+		// Azure OpenAI resource name, substituted for {endpoint}
+		Endpoint string `json:"endpoint,omitempty"`
+		// Azure OpenAI deployment name, substituted for {deployment}
+		Deployment string `json:"deployment,omitempty"`
+		// Azure OpenAI API version, substituted for {api_version}
+		APIVersion string `json:"api_version,omitempty"`
+		// ordered providers tried when the primary fails with a transport error, 429 or 5xx
+		Fallbacks []FallbackConfig `json:"fallbacks,omitempty"`
+		// retry policy applied to each provider before falling back
+		Retry *services.RetryPolicy `json:"retry,omitempty"`
+		// deadline in seconds for a whole AI call, including retries and fallbacks
+		TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+		// opt-in response cache for identical prompts
+		Cache *services.CacheSettings `json:"cache,omitempty"`
+		// circuit breaker thresholds for the providers of this service
+		CircuitBreaker *services.CircuitBreakerSettings `json:"circuit_breaker,omitempty"`
 	} `json:"config"`
 }
 
+// FallbackConfig describes one entry of a service's provider fallback chain.
+// swagger:model FallbackConfig
+type FallbackConfig struct {
+	AIProvider string `json:"ai_provider"`
+	AIModel    string `json:"ai_model"`
+	// raw API key; server will encrypt this
+	APIKey     string `json:"api_key,omitempty"`
+	APIURL     string `json:"api_url,omitempty"`
+	Endpoint   string `json:"endpoint,omitempty"`
+	Deployment string `json:"deployment,omitempty"`
+	APIVersion string `json:"api_version,omitempty"`
+}
+
 // AiSettingsResponse represents the AI settings returned to client
 // @Description AI settings configuration for a service
 type AiSettingsResponse struct {
-	AIProvider      string            `json:"ai_provider" example:"groq"`
-	AIModel         string            `json:"ai_model" example:"mixtral-8x7b-32768"`
-	EncryptedAPIKey string            `json:"encrypted_api_key" example:"encrypted_key_data"`
-	Temperature     *float64          `json:"temperature,omitempty" example:"0.7"`
-	Prompts         map[string]string `json:"prompts" example:"novice:Simple explanation,expert:Detailed analysis"`
-	APIURL          string            `json:"api_url,omitempty" example:"https://api.groq.com/openai/v1/chat/completions"`
+	AIProvider      string           `json:"ai_provider" example:"groq"`
+	AIModel         string           `json:"ai_model" example:"mixtral-8x7b-32768"`
+	EncryptedAPIKey string           `json:"encrypted_api_key" example:"encrypted_key_data"`
+	Temperature     *float64         `json:"temperature,omitempty" example:"0.7"`
+	Prompts         services.Prompts `json:"prompts" swaggertype:"object"`
+	APIURL          string           `json:"api_url,omitempty" example:"https://api.groq.com/openai/v1/chat/completions"`
+	Endpoint        string           `json:"endpoint,omitempty" example:"my-university"`
+	Deployment      string           `json:"deployment,omitempty" example:"gpt-4o-tutor"`
+	APIVersion      string           `json:"api_version,omitempty" example:"2024-02-01"`
 }
 
 // ProviderConfigResponse represents supported provider configuration
@@ -95,7 +130,7 @@ func GetSettingsHandler(dbService *services.DBService, settingsService *services
 // @Produce   json
 // @Param     request  body  handlers.ServiceConfig  true  "Service configuration update request"
 // @Success   200  {object} map[string]string  "status: success"
-// @Failure   400  {object} map[string]string  "Invalid request format or missing api_key"
+// @Failure   400  {object} map[string]string  "Invalid request format, missing api_key or incomplete provider or fallback settings"
 // @Failure   500  {object} map[string]string  "Server error encrypting or saving"
 // @Router    /settings [post]
 func UpdateSettingsHandler(dbService *services.DBService, settingsService *services.SettingsService) gin.HandlerFunc {
@@ -126,24 +161,56 @@ func UpdateSettingsHandler(dbService *services.DBService, settingsService *servi
 			return
 		}
 
+		// Reject prompts that could not be loaded back
+		if rawPrompts, ok := configMap["prompts"]; ok {
+			encoded, _ := json.Marshal(rawPrompts)
+			var prompts services.Prompts
+			if err := json.Unmarshal(encoded, &prompts); err != nil {
+				logger.Log.Warnf("Invalid prompts for service %s: %v", req.Service, err)
+				c.JSON(400, gin.H{"error": "Invalid prompts: " + err.Error()})
+				return
+			}
+		}
+
+		if err := validateProviderEntry(configMap); err != nil {
+			logger.Log.Warnf("Invalid provider settings for service %s: %v", req.Service, err)
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		// The API key is optional for local servers and the mock provider
+		provider, _ := configMap["ai_provider"].(string)
+		keyOptional := provider == "local" || provider == "mock"
+
 		// Extract and encrypt the API key
 		apiKey, ok := configMap["api_key"].(string)
-		if !ok {
+		if !ok && !keyOptional {
 			logger.Log.Warnf("API key is missing or invalid for service: %s", req.Service)
 			c.JSON(400, gin.H{"error": "API key is missing or invalid"})
 			return
 		}
-		encryptedApiKey, err := utils.Encrypt(apiKey, EncryptionKey)
-		if err != nil {
-			logger.Log.Errorf("Failed to encrypt API key: %v", err)
-			c.JSON(500, gin.H{"error": "Failed to encrypt API key"})
-			return
+		encryptedApiKey := ""
+		if apiKey != "" {
+			var err error
+			encryptedApiKey, err = utils.Encrypt(apiKey, EncryptionKey)
+			if err != nil {
+				logger.Log.Errorf("Failed to encrypt API key: %v", err)
+				c.JSON(500, gin.H{"error": "Failed to encrypt API key"})
+				return
+			}
 		}
 
 		// Update config map with encrypted API key
 		delete(configMap, "api_key")
 		configMap["encrypted_api_key"] = encryptedApiKey
 
+		// Fallback providers carry their own raw API keys
+		if err := prepareFallbacks(configMap); err != nil {
+			logger.Log.Warnf("Invalid fallbacks for service %s: %v", req.Service, err)
+			c.JSON(400, gin.H{"error": "Invalid fallbacks: " + err.Error()})
+			return
+		}
+
 		// Marshal modified config back to JSON
 		configJSON, err := json.Marshal(configMap)
 		if err != nil {
@@ -240,3 +307,102 @@ func GetSupportedProvidersHandler() gin.HandlerFunc {
 		c.JSON(200, providers)
 	}
 }
+
+// GetLocalModelsHandler godoc
+// @Summary   List local models
+// @Description  Return the models exposed via /v1/models by the local OpenAI-compatible server (Ollama, llama.cpp) configured for a service
+// @Tags      settings
+// @Produce   json
+// @Param     service  query  string  true  "Service whose local provider is queried, e.g. query"
+// @Success   200  {object} map[string][]string  "models: list of model IDs"
+// @Failure   400  {object} map[string]string  "Missing service or no local provider configured"
+// @Failure   502  {object} map[string]string  "Local server unreachable"
+// @Router    /providers/local/models [get]
+func GetLocalModelsHandler(aiService *services.AIService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service := c.Query("service")
+		if service == "" {
+			c.JSON(400, gin.H{"error": "service is required"})
+			return
+		}
+
+		models, err := aiService.ListLocalModels(c.Request.Context(), service)
+		if err != nil {
+			if errors.Is(err, services.ErrNoLocalProvider) {
+				c.JSON(400, gin.H{"error": "Service has no local provider configured"})
+				return
+			}
+			logger.Log.Errorf("Failed to list local models for %s: %v", service, err)
+			c.JSON(502, gin.H{"error": "Failed to list models from local server"})
+			return
+		}
+
+		logger.Log.Debugf("Retrieved %d models from the local server of %s", len(models), service)
+		c.JSON(200, gin.H{"models": models})
+	}
+}
+
+// validateProviderEntry checks the provider-specific settings of the primary entry or a fallback
+func validateProviderEntry(entry map[string]interface{}) error {
+	switch provider, _ := entry["ai_provider"].(string); provider {
+	case "azure-openai":
+		// Azure OpenAI needs the resource and deployment names to build its URL
+		apiURL, _ := entry["api_url"].(string)
+		if apiURL == "" {
+			apiURL = services.GetProviderConfig("azure-openai").DefaultURL
+		}
+		endpoint, _ := entry["endpoint"].(string)
+		deployment, _ := entry["deployment"].(string)
+		if (strings.Contains(apiURL, "{endpoint}") && endpoint == "") ||
+			(strings.Contains(apiURL, "{deployment}") && deployment == "") {
+			return errors.New("Azure OpenAI requires endpoint and deployment")
+		}
+	case "local":
+		// Local servers need a base URL
+		if apiURL, _ := entry["api_url"].(string); apiURL == "" {
+			return errors.New("Local provider requires api_url")
+		}
+	}
+	return nil
+}
+
+// prepareFallbacks validates every fallback entry like the primary one and replaces its raw api_key
+// with the encrypted form
+func prepareFallbacks(configMap map[string]interface{}) error {
+	rawFallbacks, ok := configMap["fallbacks"]
+	if !ok || rawFallbacks == nil {
+		return nil
+	}
+	fallbacks, ok := rawFallbacks.([]interface{})
+	if !ok {
+		return fmt.Errorf("fallbacks must be a list")
+	}
+
+	for i, rawEntry := range fallbacks {
+		entry, ok := rawEntry.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("fallback %d must be an object", i)
+		}
+		if provider, _ := entry["ai_provider"].(string); provider == "" {
+			return fmt.Errorf("fallback %d is missing ai_provider", i)
+		}
+		if model, _ := entry["ai_model"].(string); model == "" {
+			return fmt.Errorf("fallback %d is missing ai_model", i)
+		}
+		if err := validateProviderEntry(entry); err != nil {
+			return fmt.Errorf("fallback %d: %v", i, err)
+		}
+
+		apiKey, _ := entry["api_key"].(string)
+		delete(entry, "api_key")
+		if apiKey == "" {
+			continue
+		}
+		encryptedApiKey, err := utils.Encrypt(apiKey, EncryptionKey)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt API key of fallback %d", i)
+		}
+		entry["encrypted_api_key"] = encryptedApiKey
+	}
+	return nil
+}
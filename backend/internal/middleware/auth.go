@@ -1,123 +1,163 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/handlers"
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/logger"
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/services"
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get token from Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "No authorization header"})
-			c.Abort()
-			return
-		}
-
-		// Remove "Bearer " prefix
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
-			c.Abort()
+		_, username, ok := authenticateBearer(c)
+		if !ok {
 			return
 		}
 
-		// Parse and validate the token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(handlers.EncryptionKey), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
-		}
+		// Set username in context
+		c.Set("username", username)
+		c.Next()
+	}
+}
 
-		// Extract claims
-		claims, ok := token.Claims.(jwt.MapClaims)
+func AdminMiddleware(dbService interface{}) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, username, ok := authenticateBearer(c)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			c.Abort()
 			return
 		}
 
-		// Get username from claims
-		username, ok := claims["username"].(string)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		// Check if user has admin or superadmin role
+		role, ok := claims["role"].(string)
+		if !ok || (role != "admin" && role != "superadmin") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
 			c.Abort()
 			return
 		}
 
 		// Set username in context
 		c.Set("username", username)
+		c.Set("role", role)
 		c.Next()
 	}
 }
 
-func AdminMiddleware(dbService interface{}) gin.HandlerFunc {
+// IdentifyUserMiddleware resolves the caller from a JWT or a personal API token and stores
+// username, role and user_id in the context. Anonymous callers pass through unless requireAuth is set,
+// but a credential that is present must be valid.
+func IdentifyUserMiddleware(dbService *services.DBService, requireAuth bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// First run the auth middleware logic
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "No authorization header"})
-			c.Abort()
-			return
-		}
-
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
-			c.Abort()
+			if requireAuth {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+				c.Abort()
+				return
+			}
+			c.Next()
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		// Personal API tokens are looked up by their hash
+		if tokenString := strings.TrimPrefix(authHeader, "Bearer "); strings.HasPrefix(tokenString, utils.APITokenPrefix) {
+			user, err := dbService.GetUserByAPITokenHash(c.Request.Context(), utils.HashAPIToken(tokenString))
+			if err != nil {
+				logger.Log.Errorf("Failed to look up API token: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				c.Abort()
+				return
 			}
-			return []byte(handlers.EncryptionKey), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
+			if user == nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API token"})
+				c.Abort()
+				return
+			}
+			setUser(c, user)
+			c.Next()
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
+		_, username, ok := authenticateBearer(c)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			c.Abort()
 			return
 		}
 
-		username, ok := claims["username"].(string)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		// Tokens of deleted users are rejected
+		user, err := dbService.GetUserProfile(username)
+		if errors.Is(err, services.ErrUserNotFound) {
+			logger.Log.Warnf("Token for unknown user %s", username)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
-		// Check if user has admin or superadmin role
-		role, ok := claims["role"].(string)
-		if !ok || (role != "admin" && role != "superadmin") {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		if err != nil {
+			logger.Log.Errorf("Failed to look up user %s: %v", username, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			c.Abort()
 			return
 		}
-
-		// Set username in context
-		c.Set("username", username)
-		c.Set("role", role)
+		setUser(c, user)
 		c.Next()
 	}
 }
+
+// authenticateBearer validates the login JWT in the Authorization header and returns its claims and
+// username. It responds with 401 and returns false when the header is missing or the token is invalid.
+func authenticateBearer(c *gin.Context) (jwt.MapClaims, string, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No authorization header"})
+		c.Abort()
+		return nil, "", false
+	}
+
+	// Remove "Bearer " prefix
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
+		c.Abort()
+		return nil, "", false
+	}
+
+	// Parse and validate the token
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(handlers.EncryptionKey), nil
+	})
+	if err != nil || !token.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return nil, "", false
+	}
+
+	// Extract the claims and the username
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		c.Abort()
+		return nil, "", false
+	}
+	username, ok := claims["username"].(string)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		c.Abort()
+		return nil, "", false
+	}
+	return claims, username, true
+}
+
+// setUser stores the authenticated user in the context
+func setUser(c *gin.Context, user *services.User) {
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("user_id", user.ID)
+}
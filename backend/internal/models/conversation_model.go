@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Conversation groups the queries of one chat thread
+type Conversation struct {
+	ID        string
+	UserID    *int // Owner of the thread; threads without one are never shown to anyone
+	Title     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,25 @@
+package models
+
+import "encoding/json"
+
+// Suggestion is a stored code analysis suggestion
+type Suggestion struct {
+	ID       int
+	QueryID  string
+	Position int // Index in the analyze response
+	Line     int
+	Message  string
+	Details  json.RawMessage // Suggestion as returned to the client
+}
+
+// Feedback is a user's judgement of an answer or of a single suggestion
+type Feedback struct {
+	ID           int
+	QueryID      string
+	SuggestionID *int // nil for feedback on the whole answer
+	UserID       *int // nil for anonymous feedback
+	Vote         *string
+	Rating       *int
+	Comment      *string
+	Reasons      []string
+}
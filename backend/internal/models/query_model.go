@@ -1,10 +1,22 @@
 package models
 
+import "time"
+
 type Query struct {
-	ID       string
-	Query    string
-	Provider string
-	Level    string
-	Response string
-	Feedback *string // Pointer to allow NULL in database
+	ID               string
+	ConversationID   *string // Thread the query belongs to, nil for one-off queries
+	UserID           *int    // Owner of the query, nil for anonymous callers
+	Service          string  // AI service that handled the request, e.g. "query" or "analyze"
+	Query            string
+	Provider         string
+	Model            string
+	Level            string
+	PromptVersion    string // Hash of the level prompt, see services.PromptVersion
+	Response         string
+	Feedback         *string // Pointer to allow NULL in database
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	LatencyMs        int64
+	CreatedAt        time.Time
 }
@@ -1,17 +1,27 @@
 package services
 
 import (
-	"bytes"
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/logger"
 )
 
 // AIService manages interactions with the AI API
 type AIService struct {
 	settingsService *SettingsService
 	client          *http.Client
+	memoryCache     ResponseCache
+	postgresCache   ResponseCache
+	breakers        *circuitBreakers
 }
 
 // NewAIService creates a new AI service instance
@@ -19,84 +29,543 @@ func NewAIService(settingsService *SettingsService) *AIService {
 	return &AIService{
 		settingsService: settingsService,
 		client:          &http.Client{},
+		memoryCache:     newMemoryCache(defaultCacheCapacity),
+		postgresCache:   &postgresCache{dbService: settingsService.dbService},
+		breakers:        newCircuitBreakers(),
 	}
 }
 
-func (s *AIService) GetResponse(service string, provider string, model string, prompt string) (string, error) {
+// AIResponse is the result of a completion call
+type AIResponse struct {
+	Content  string
+	Provider string // Provider that actually answered, which may be a fallback
+	Model    string
+	Usage    TokenUsage
+	Latency  time.Duration // Wall-clock time of the whole call, including retries and fallbacks
+	Cached   bool          // Served from the response cache without calling the provider
+}
+
+// ProviderError is returned when a provider answers with a non-200 status
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // Wait requested through Retry-After or rate limit headers
+}
+
+// newProviderError builds a ProviderError from a non-200 provider response
+func newProviderError(provider string, resp *http.Response) *ProviderError {
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	return &ProviderError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Body:       string(bodyBytes),
+		RetryAfter: parseRetryAfter(resp.Header, time.Now()),
+	}
+}
+
+// errStreamInterrupted marks failures after part of a stream was already relayed to the client
+var errStreamInterrupted = errors.New("stream interrupted")
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("AI service %s returned status %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// GetResponse sends the conversation to the service's provider, falling back to the next configured
+// provider on transport errors, 429 or 5xx responses. The whole call is bounded by the service timeout.
+// Messages hold the system instructions, prior turns and, last, the current user turn.
+func (s *AIService) GetResponse(ctx context.Context, service string, provider string, model string, messages []ChatMessage) (*AIResponse, error) {
+	return s.getResponse(ctx, service, provider, model, messages, nil, nil)
+}
+
+// GetJSONResponse works like GetResponse but asks for a JSON object matching schema, using JSON mode or
+// tool calling where the provider supports it. The content is not validated here; validate decides
+// whether a reply may be cached, so replies the caller rejects are not served again.
+func (s *AIService) GetJSONResponse(ctx context.Context, service string, provider string, model string, messages []ChatMessage, schema *ResponseSchema, validate func(content string) error) (*AIResponse, error) {
+	return s.getResponse(ctx, service, provider, model, messages, schema, validate)
+}
+
+// getResponse performs a non-streamed completion call, optionally requesting structured output.
+// Replies are cached unless validate rejects them.
+func (s *AIService) getResponse(ctx context.Context, service string, provider string, model string, messages []ChatMessage, schema *ResponseSchema, validate func(content string) error) (*AIResponse, error) {
 	settings, err := s.settingsService.GetAiSettings(service)
-	fmt.Printf("GetResponse: settings=%v\n | err=%v\n", settings, err)
 	if err != nil {
-		return "", fmt.Errorf("failed to get AI settings: %w", err)
+		return nil, fmt.Errorf("failed to get AI settings: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, settings.Timeout())
+	defer cancel()
+
+	format := ""
+	if schema != nil {
+		format = schema.Name
+	}
+
+	start := time.Now()
+	cacheKey := responseCacheKey(service, provider, model, settings.temperature(), format, messages)
+	if cached := s.getCachedResponse(ctx, settings, cacheKey, start); cached != nil {
+		return cached, nil
+	}
+
+	var lastErr error
+	for i, entry := range providerChain(settings, provider, model) {
+		completionReq, err := s.buildCompletionRequest(settings, &entry, messages)
+		if err != nil {
+			return nil, err
+		}
+		completionReq.Schema = schema
+
+		var completion *Completion
+		err = s.callProvider(ctx, settings, completionReq, func() error {
+			var callErr error
+			completion, callErr = s.GetResponseGeneral(ctx, GetProviderAdapter(entry.AIProvider), completionReq)
+			return callErr
+		})
+		if err == nil {
+			response := newAIResponse(completion, &entry, start)
+			if validate == nil || validate(response.Content) == nil {
+				s.cacheResponse(ctx, settings, service, cacheKey, response)
+			}
+			return response, nil
+		}
+		if !isFallbackError(err) {
+			return nil, err
+		}
+		logger.Log.Warnf("Provider %s (chain position %d) failed for service %s: %v", entry.AIProvider, i, service, err)
+		lastErr = err
+	}
+	return nil, fmt.Errorf("all providers failed for service %s: %w", service, lastErr)
+}
+
+// StreamResponse requests a streamed completion and calls onDelta for every text fragment received.
+// It returns the full response once the stream ends. Providers that cannot stream answer with a
+// normal completion sent as a single delta. Fallback providers are only tried while nothing has
+// been sent to the client yet.
+func (s *AIService) StreamResponse(ctx context.Context, service string, provider string, model string, messages []ChatMessage, onDelta func(string) error) (*AIResponse, error) {
+	settings, err := s.settingsService.GetAiSettings(service)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AI settings: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, settings.Timeout())
+	defer cancel()
+
+	start := time.Now()
+	cacheKey := responseCacheKey(service, provider, model, settings.temperature(), "", messages)
+	if cached := s.getCachedResponse(ctx, settings, cacheKey, start); cached != nil {
+		// Replay the cached answer as a single delta
+		if err := onDelta(cached.Content); err != nil {
+			return nil, err
+		}
+		return cached, nil
+	}
+
+	var lastErr error
+	for i, entry := range providerChain(settings, provider, model) {
+		baseAdapter := GetProviderAdapter(entry.AIProvider)
+		direct, isDirect := baseAdapter.(DirectAdapter)
+		adapter, canStream := baseAdapter.(StreamingAdapter)
+		completionReq, err := s.buildCompletionRequest(settings, &entry, messages)
+		if err != nil {
+			return nil, err
+		}
+		completionReq.Stream = isDirect || canStream
+
+		var completion *Completion
+		err = s.callProvider(ctx, settings, completionReq, func() error {
+			var callErr error
+			switch {
+			case isDirect:
+				completion, callErr = streamDirect(ctx, direct, completionReq, onDelta)
+			case canStream:
+				completion, callErr = s.streamCompletion(ctx, adapter, completionReq, onDelta)
+			default:
+				completion, callErr = s.streamWhole(ctx, baseAdapter, completionReq, onDelta)
+			}
+			return callErr
+		})
+		if err == nil {
+			response := newAIResponse(completion, &entry, start)
+			s.cacheResponse(ctx, settings, service, cacheKey, response)
+			return response, nil
+		}
+		if !isFallbackError(err) {
+			return nil, err
+		}
+		logger.Log.Warnf("Provider %s (chain position %d) failed to stream for service %s: %v", entry.AIProvider, i, service, err)
+		lastErr = err
+	}
+	return nil, fmt.Errorf("all providers failed for service %s: %w", service, lastErr)
+}
+
+// streamCompletion performs a single streamed call. Errors after the first relayed delta
+// are wrapped with errStreamInterrupted so they are neither retried nor sent to a fallback.
+func (s *AIService) streamCompletion(ctx context.Context, adapter StreamingAdapter, completionReq *CompletionRequest, onDelta func(string) error) (*Completion, error) {
+	req, err := adapter.BuildRequest(ctx, completionReq)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newProviderError(completionReq.Provider, resp)
+	}
+
+	var full strings.Builder
+	var usage TokenUsage
+	fail := func(err error) (*Completion, error) {
+		if full.Len() > 0 {
+			return nil, fmt.Errorf("%w: %w", errStreamInterrupted, err)
+		}
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+
+		event, err := adapter.ParseStreamEvent([]byte(data))
+		if err != nil {
+			return fail(err)
+		}
+		if event.Usage != nil {
+			usage.add(*event.Usage)
+		}
+		if event.Delta != "" {
+			full.WriteString(event.Delta)
+			if err := onDelta(event.Delta); err != nil {
+				return fail(err)
+			}
+		}
+		if event.Done {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fail(fmt.Errorf("failed to read stream: %w", err))
+	}
+	return &Completion{Content: full.String(), Usage: usage}, nil
+}
+
+// streamDirect relays the answer of an in-process adapter word by word, mimicking a provider stream
+func streamDirect(ctx context.Context, direct DirectAdapter, completionReq *CompletionRequest, onDelta func(string) error) (*Completion, error) {
+	completion, err := direct.Complete(ctx, completionReq)
+	if err != nil {
+		return nil, err
+	}
+	for i, word := range strings.SplitAfter(completion.Content, " ") {
+		if err := onDelta(word); err != nil {
+			if i > 0 {
+				return nil, fmt.Errorf("%w: %w", errStreamInterrupted, err)
+			}
+			return nil, err
+		}
+	}
+	return completion, nil
+}
+
+// streamWhole performs a normal completion call for a provider that cannot stream and relays the
+// answer as a single delta
+func (s *AIService) streamWhole(ctx context.Context, adapter ProviderAdapter, completionReq *CompletionRequest, onDelta func(string) error) (*Completion, error) {
+	completion, err := s.GetResponseGeneral(ctx, adapter, completionReq)
+	if err != nil {
+		return nil, err
+	}
+	if err := onDelta(completion.Content); err != nil {
+		return nil, err
+	}
+	return completion, nil
+}
+
+// newAIResponse wraps a completion with the provider that produced it and the time taken since start
+func newAIResponse(completion *Completion, entry *ProviderEntry, start time.Time) *AIResponse {
+	return &AIResponse{
+		Content:  completion.Content,
+		Provider: entry.AIProvider,
+		Model:    entry.AIModel,
+		Usage:    completion.Usage,
+		Latency:  time.Since(start),
+	}
+}
+
+// callProvider guards a call to one provider with its circuit breaker and the service's retry policy
+func (s *AIService) callProvider(ctx context.Context, settings *AiSettings, completionReq *CompletionRequest, call func() error) error {
+	cfg := settings.CircuitBreaker.withDefaults()
+	breaker := s.breakers.get(completionReq.Provider, completionReq.URL)
+	if !breaker.allow(cfg) {
+		return fmt.Errorf("provider %s skipped: %w", completionReq.Provider, ErrCircuitOpen)
+	}
+
+	err := s.withRetry(ctx, settings.Retry, completionReq.Provider, call)
+	switch {
+	case err == nil:
+		breaker.recordSuccess()
+	case isFallbackError(err) || errors.Is(err, context.DeadlineExceeded):
+		breaker.recordFailure(cfg)
+	default:
+		breaker.release()
+	}
+	return err
+}
+
+// ProviderHealth returns the circuit breaker state of every provider that has been called
+func (s *AIService) ProviderHealth() []ProviderHealth {
+	return s.breakers.health()
+}
+
+// withRetry runs call until it succeeds, fails permanently or the policy's attempts are used up.
+// Waits follow the provider's Retry-After hint when present, otherwise jittered exponential backoff.
+func (s *AIService) withRetry(ctx context.Context, retryPolicy *RetryPolicy, provider string, call func() error) error {
+	policy := retryPolicy.withDefaults()
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= policy.MaxAttempts || !isFallbackError(err) {
+			return err
+		}
+
+		wait := policy.backoff(attempt)
+		if delay := retryDelay(err); delay > 0 {
+			// Give up on this provider when it asks for a longer pause than we are willing to wait
+			if delay > policy.maxBackoff() {
+				return err
+			}
+			wait = delay
+		}
+		logger.Log.Warnf("Provider %s attempt %d/%d failed, retrying in %s: %v", provider, attempt, policy.MaxAttempts, wait, err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// providerChain returns the ordered providers to try: the requested primary followed by the configured fallbacks
+func providerChain(settings *AiSettings, provider string, model string) []ProviderEntry {
+	primary := settings.ProviderEntry
+	primary.AIProvider = provider
+	primary.AIModel = model
+	return append([]ProviderEntry{primary}, settings.Fallbacks...)
+}
+
+// isFallbackError reports whether an error warrants trying the next provider in the chain
+func isFallbackError(err error) bool {
+	if errors.Is(err, errStreamInterrupted) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.StatusCode == http.StatusTooManyRequests || providerErr.StatusCode >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// buildCompletionRequest resolves a provider entry of a service into a provider-agnostic completion request
+func (s *AIService) buildCompletionRequest(settings *AiSettings, entry *ProviderEntry, messages []ChatMessage) (*CompletionRequest, error) {
+	system, history, prompt, err := splitMessages(messages)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get the API URL for this provider (either custom or default)
-	apiURL := s.settingsService.GetProviderAPIURL(provider, settings)
+	apiURL := s.settingsService.GetProviderAPIURL(entry.AIProvider, entry)
 	if apiURL == "" {
-		return "", fmt.Errorf("no API URL configured for provider: %s", provider)
+		return nil, fmt.Errorf("no API URL configured for provider: %s", entry.AIProvider)
 	}
 
-	return s.GetResponseGeneral(settings.APIKey, model, prompt, apiURL, settings.Temperature)
+	return &CompletionRequest{
+		Provider:    entry.AIProvider,
+		URL:         apiURL,
+		APIKey:      entry.APIKey,
+		Model:       entry.AIModel,
+		System:      system,
+		History:     history,
+		Prompt:      prompt,
+		Temperature: settings.temperature(),
+		Mock:        entry.Mock,
+	}, nil
 }
 
-func (s *AIService) GetResponseGeneral(apiKey string, model string, prompt string, url string, temperature *float64) (string, error) {
-	temp := 0.7
-	if temperature != nil {
-		temp = *temperature
+// splitMessages separates a message list into system instructions, prior turns and the current user turn
+func splitMessages(messages []ChatMessage) (string, []ChatMessage, string, error) {
+	if len(messages) == 0 || messages[len(messages)-1].Role != RoleUser {
+		return "", nil, "", fmt.Errorf("the last message must be a user turn")
 	}
 
-	reqBody, err := json.Marshal(map[string]interface{}{
-		"model":       model,
-		"temperature": temp,
-		"messages": []map[string]string{
-			{"role": "user", "content": prompt},
-		},
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request body: %w", err)
+	var system []string
+	var history []ChatMessage
+	for _, msg := range messages[:len(messages)-1] {
+		switch msg.Role {
+		case RoleSystem:
+			system = append(system, msg.Content)
+		case RoleUser, RoleAssistant:
+			history = append(history, msg)
+		default:
+			return "", nil, "", fmt.Errorf("unknown message role: %s", msg.Role)
+		}
+	}
+	return strings.Join(system, "\n\n"), history, messages[len(messages)-1].Content, nil
+}
+
+// cacheStores returns the caches enabled for a service, fastest first
+func (s *AIService) cacheStores(settings *AiSettings) []ResponseCache {
+	if settings.Cache == nil || !settings.Cache.Enabled {
+		return nil
+	}
+	if settings.Cache.Store == "postgres" {
+		return []ResponseCache{s.memoryCache, s.postgresCache}
+	}
+	return []ResponseCache{s.memoryCache}
+}
+
+// getCachedResponse looks the key up in the service's caches and returns a response flagged as cached
+func (s *AIService) getCachedResponse(ctx context.Context, settings *AiSettings, key string, start time.Time) *AIResponse {
+	for i, cache := range s.cacheStores(settings) {
+		entry, ok := cache.Get(ctx, key)
+		if !ok {
+			continue
+		}
+		// Promote entries found in slower stores to the in-memory LRU
+		if i > 0 {
+			s.memoryCache.Set(ctx, key, entry)
+		}
+		return &AIResponse{
+			Content:  entry.Content,
+			Provider: entry.Provider,
+			Model:    entry.Model,
+			Latency:  time.Since(start),
+			Cached:   true,
+		}
+	}
+	return nil
+}
+
+// cacheResponse stores a fresh response in every cache enabled for the service
+func (s *AIService) cacheResponse(ctx context.Context, settings *AiSettings, service string, key string, response *AIResponse) {
+	stores := s.cacheStores(settings)
+	if len(stores) == 0 {
+		return
+	}
+	entry := &CachedResponse{
+		Service:   service,
+		Provider:  response.Provider,
+		Model:     response.Model,
+		Content:   response.Content,
+		ExpiresAt: time.Now().Add(settings.Cache.ttl()),
+	}
+	for _, cache := range stores {
+		if err := cache.Set(ctx, key, entry); err != nil {
+			logger.Log.Warnf("Failed to cache response for service %s: %v", service, err)
+		}
+	}
+}
+
+// PurgeCache removes cached responses of a service, or of all services when service is empty
+func (s *AIService) PurgeCache(ctx context.Context, service string) error {
+	if err := s.memoryCache.Purge(ctx, service); err != nil {
+		return err
+	}
+	return s.postgresCache.Purge(ctx, service)
+}
+
+// GetResponseGeneral sends a completion request through the provider adapter and returns the parsed completion
+func (s *AIService) GetResponseGeneral(ctx context.Context, adapter ProviderAdapter, completionReq *CompletionRequest) (*Completion, error) {
+	if direct, ok := adapter.(DirectAdapter); ok {
+		return direct.Complete(ctx, completionReq)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(reqBody))
+	req, err := adapter.BuildRequest(ctx, completionReq)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	// Check HTTP status code
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("AI service returned status %d: %s", resp.StatusCode, string(bodyBytes))
+		return nil, newProviderError(completionReq.Provider, resp)
 	}
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	return adapter.ParseResponse(bodyBytes)
+}
+
+// localModelsTimeout bounds a model listing request to a local server
+const localModelsTimeout = 10 * time.Second
+
+// ErrNoLocalProvider is returned when a service has no local provider configured
+var ErrNoLocalProvider = errors.New("service has no local provider")
+
+// ListLocalModels returns the model IDs exposed via /v1/models by the local OpenAI-compatible server
+// configured for a service, as its primary provider or one of its fallbacks
+func (s *AIService) ListLocalModels(ctx context.Context, service string) ([]string, error) {
+	settings, err := s.settingsService.GetAiSettings(service)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoLocalProvider, err)
+	}
+	baseURL := ""
+	for _, entry := range append([]ProviderEntry{settings.ProviderEntry}, settings.Fallbacks...) {
+		if entry.AIProvider == "local" && entry.APIURL != "" {
+			baseURL = entry.APIURL
+			break
+		}
+	}
+	if baseURL == "" {
+		return nil, ErrNoLocalProvider
 	}
 
-	// Log the full response for debugging
-	fmt.Printf("AI Response: %+v\n", result)
+	ctx, cancel := context.WithTimeout(ctx, localModelsTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", LocalModelsURL(baseURL), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-	// Extract response content
-	choices, ok := result["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
-		return "", fmt.Errorf("invalid response: no choices")
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("model listing returned status %d: %s", resp.StatusCode, string(bodyBytes))
 	}
-	firstChoice, ok := choices[0].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("invalid choice format")
+
+	var result struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
 	}
-	message, ok := firstChoice["message"].(map[string]interface{})
-	if !ok {
-		return "", fmt.Errorf("invalid message format")
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode model list: %w", err)
 	}
-	content, ok := message["content"].(string)
-	if !ok {
-		return "", fmt.Errorf("content not a string")
+
+	models := make([]string, 0, len(result.Data))
+	for _, model := range result.Data {
+		models = append(models, model.ID)
 	}
-	return content, nil
+	return models, nil
 }
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 4096
+)
+
+// AnthropicAdapter speaks the native Anthropic Messages API
+type AnthropicAdapter struct{}
+
+// BuildRequest creates a Messages API request with x-api-key auth and a top-level system field
+func (a *AnthropicAdapter) BuildRequest(ctx context.Context, req *CompletionRequest) (*http.Request, error) {
+	messages := []map[string]string{}
+	for _, msg := range req.History {
+		// The Messages API requires the conversation to start with a user turn
+		if len(messages) == 0 && msg.Role != RoleUser {
+			continue
+		}
+		messages = append(messages, map[string]string{"role": msg.Role, "content": msg.Content})
+	}
+	messages = append(messages, map[string]string{"role": "user", "content": req.Prompt})
+
+	body := map[string]interface{}{
+		"model":       req.Model,
+		"max_tokens":  anthropicDefaultMaxTokens,
+		"temperature": req.Temperature,
+		"messages":    messages,
+	}
+	if req.System != "" {
+		body["system"] = req.System
+	}
+	if req.Stream {
+		body["stream"] = true
+	}
+	// Structured output is requested by forcing a single tool call whose input follows the schema
+	if req.Schema != nil {
+		body["tools"] = []map[string]interface{}{{
+			"name":         req.Schema.Name,
+			"description":  req.Schema.Description,
+			"input_schema": req.Schema.Schema,
+		}}
+		body["tool_choice"] = map[string]string{"type": "tool", "name": req.Schema.Name}
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", req.URL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("x-api-key", req.APIKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+	httpReq.Header.Set("Content-Type", "application/json")
+	return httpReq, nil
+}
+
+// anthropicUsage is the usage block of the Messages API
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (u anthropicUsage) toTokenUsage() TokenUsage {
+	return TokenUsage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.InputTokens + u.OutputTokens,
+	}
+}
+
+// ParseResponse joins the text blocks of the content[] array. The input of a tool call, as made
+// for structured requests, is returned as the JSON content instead.
+func (a *AnthropicAdapter) ParseResponse(body []byte) (*Completion, error) {
+	var result struct {
+		Content []struct {
+			Type  string          `json:"type"`
+			Text  string          `json:"text"`
+			Input json.RawMessage `json:"input"`
+		} `json:"content"`
+		Usage anthropicUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	var sb strings.Builder
+	found := false
+	for _, block := range result.Content {
+		if block.Type == "tool_use" {
+			return &Completion{Content: string(block.Input), Usage: result.Usage.toTokenUsage()}, nil
+		}
+		if block.Type != "text" {
+			continue
+		}
+		sb.WriteString(block.Text)
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("invalid response: no text content")
+	}
+	return &Completion{Content: sb.String(), Usage: result.Usage.toTokenUsage()}, nil
+}
+
+// ParseStreamEvent handles the events of the Messages streaming API. Input tokens are reported
+// in message_start and output tokens in message_delta.
+func (a *AnthropicAdapter) ParseStreamEvent(data []byte) (*StreamEvent, error) {
+	var event struct {
+		Type  string `json:"type"`
+		Delta struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"delta"`
+		Message struct {
+			Usage anthropicUsage `json:"usage"`
+		} `json:"message"`
+		Usage anthropicUsage `json:"usage"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode stream event: %w", err)
+	}
+
+	switch event.Type {
+	case "message_start":
+		usage := TokenUsage{PromptTokens: event.Message.Usage.InputTokens}
+		return &StreamEvent{Usage: &usage}, nil
+	case "content_block_delta":
+		if event.Delta.Type == "text_delta" {
+			return &StreamEvent{Delta: event.Delta.Text}, nil
+		}
+	case "message_delta":
+		usage := TokenUsage{CompletionTokens: event.Usage.OutputTokens}
+		return &StreamEvent{Usage: &usage}, nil
+	case "message_stop":
+		return &StreamEvent{Done: true}, nil
+	case "error":
+		return nil, fmt.Errorf("AI service stream error: %s", event.Error.Message)
+	}
+	return &StreamEvent{}, nil
+}
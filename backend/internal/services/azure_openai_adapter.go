@@ -0,0 +1,23 @@
+package services
+
+import (
+	"context"
+	"net/http"
+)
+
+// AzureOpenAIAdapter speaks the Azure OpenAI chat completions API.
+// The payload matches OpenAI but authentication uses the api-key header.
+type AzureOpenAIAdapter struct {
+	OpenAIAdapter
+}
+
+// BuildRequest creates an OpenAI-style request authenticated with the api-key header
+func (a *AzureOpenAIAdapter) BuildRequest(ctx context.Context, req *CompletionRequest) (*http.Request, error) {
+	httpReq, err := a.OpenAIAdapter.BuildRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Del("Authorization")
+	httpReq.Header.Set("api-key", req.APIKey)
+	return httpReq, nil
+}
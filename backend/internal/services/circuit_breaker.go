@@ -0,0 +1,210 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerOpenSeconds      = 30
+	defaultBreakerHalfOpenRequests = 1
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// ErrCircuitOpen is returned when a provider is skipped because its circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitBreakerSettings controls when calls to a failing provider are short-circuited
+type CircuitBreakerSettings struct {
+	FailureThreshold    int `json:"failure_threshold,omitempty"`      // Consecutive failures that open the circuit
+	OpenSeconds         int `json:"open_seconds,omitempty"`           // Time the circuit stays open before probing
+	HalfOpenMaxRequests int `json:"half_open_max_requests,omitempty"` // Concurrent probe calls allowed while half-open
+}
+
+// withDefaults returns a copy of the settings with unset fields filled in
+func (c *CircuitBreakerSettings) withDefaults() CircuitBreakerSettings {
+	cfg := CircuitBreakerSettings{
+		FailureThreshold:    defaultBreakerFailureThreshold,
+		OpenSeconds:         defaultBreakerOpenSeconds,
+		HalfOpenMaxRequests: defaultBreakerHalfOpenRequests,
+	}
+	if c == nil {
+		return cfg
+	}
+	if c.FailureThreshold > 0 {
+		cfg.FailureThreshold = c.FailureThreshold
+	}
+	if c.OpenSeconds > 0 {
+		cfg.OpenSeconds = c.OpenSeconds
+	}
+	if c.HalfOpenMaxRequests > 0 {
+		cfg.HalfOpenMaxRequests = c.HalfOpenMaxRequests
+	}
+	return cfg
+}
+
+// ProviderHealth is a snapshot of a provider's circuit breaker
+type ProviderHealth struct {
+	Provider            string     `json:"provider"`
+	URL                 string     `json:"url"`
+	State               string     `json:"state"`  // closed, open or half-open
+	Status              string     `json:"status"` // healthy, degraded or down
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+}
+
+// circuitBreaker tracks the failures of a single provider URL
+type circuitBreaker struct {
+	mu                  sync.Mutex
+	provider            string
+	url                 string
+	state               string
+	consecutiveFailures int
+	halfOpenInFlight    int
+	lastFailure         time.Time
+	openedAt            time.Time
+}
+
+// allow reports whether a call may go through, moving an expired open circuit to half-open
+func (b *circuitBreaker) allow(cfg CircuitBreakerSettings) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < time.Duration(cfg.OpenSeconds)*time.Second {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.halfOpenInFlight = 0
+		fallthrough
+	case BreakerHalfOpen:
+		if b.halfOpenInFlight >= cfg.HalfOpenMaxRequests {
+			return false
+		}
+		b.halfOpenInFlight++
+		return true
+	default:
+		return true
+	}
+}
+
+// recordSuccess closes the circuit
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = BreakerClosed
+	b.consecutiveFailures = 0
+	b.halfOpenInFlight = 0
+}
+
+// recordFailure counts a failure and opens the circuit once the threshold is reached or a probe fails
+func (b *circuitBreaker) recordFailure(cfg CircuitBreakerSettings) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutiveFailures++
+	b.lastFailure = time.Now()
+	if b.state == BreakerHalfOpen || b.consecutiveFailures >= cfg.FailureThreshold {
+		b.state = BreakerOpen
+		b.openedAt = b.lastFailure
+		b.halfOpenInFlight = 0
+	}
+}
+
+// release frees a half-open probe slot for calls that ended without a verdict, e.g. client cancellation
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen && b.halfOpenInFlight > 0 {
+		b.halfOpenInFlight--
+	}
+}
+
+// health returns a snapshot of the breaker
+func (b *circuitBreaker) health() ProviderHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := ProviderHealth{
+		Provider:            b.provider,
+		URL:                 b.url,
+		State:               b.state,
+		ConsecutiveFailures: b.consecutiveFailures,
+	}
+	switch {
+	case b.state == BreakerOpen:
+		h.Status = "down"
+	case b.state == BreakerHalfOpen || b.consecutiveFailures > 0:
+		h.Status = "degraded"
+	default:
+		h.Status = "healthy"
+	}
+	if !b.lastFailure.IsZero() {
+		lastFailure := b.lastFailure
+		h.LastFailure = &lastFailure
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		h.OpenedAt = &openedAt
+	}
+	return h
+}
+
+// circuitBreakers holds one breaker per provider and URL
+type circuitBreakers struct {
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newCircuitBreakers() *circuitBreakers {
+	return &circuitBreakers{breakers: make(map[string]*circuitBreaker)}
+}
+
+// get returns the breaker for a provider URL, creating it closed on first use
+func (c *circuitBreakers) get(provider, url string) *circuitBreaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := provider + " " + url
+	breaker, ok := c.breakers[key]
+	if !ok {
+		breaker = &circuitBreaker{provider: provider, url: url, state: BreakerClosed}
+		c.breakers[key] = breaker
+	}
+	return breaker
+}
+
+// health returns the state of every known breaker, sorted by provider and URL
+func (c *circuitBreakers) health() []ProviderHealth {
+	c.mu.Lock()
+	breakers := make([]*circuitBreaker, 0, len(c.breakers))
+	for _, breaker := range c.breakers {
+		breakers = append(breakers, breaker)
+	}
+	c.mu.Unlock()
+
+	healths := make([]ProviderHealth, 0, len(breakers))
+	for _, breaker := range breakers {
+		healths = append(healths, breaker.health())
+	}
+	sort.Slice(healths, func(i, j int) bool {
+		if healths[i].Provider != healths[j].Provider {
+			return healths[i].Provider < healths[j].Provider
+		}
+		return healths[i].URL < healths[j].URL
+	})
+	return healths
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// CohereAdapter speaks the Cohere v1 chat API
+type CohereAdapter struct{}
+
+// BuildRequest maps the system prompt to preamble and prior turns to chat_history
+func (a *CohereAdapter) BuildRequest(ctx context.Context, req *CompletionRequest) (*http.Request, error) {
+	chatHistory := []map[string]string{}
+	for _, msg := range req.History {
+		chatHistory = append(chatHistory, map[string]string{
+			"role":    cohereRole(msg.Role),
+			"message": msg.Content,
+		})
+	}
+
+	body := map[string]interface{}{
+		"model":       req.Model,
+		"message":     req.Prompt,
+		"temperature": req.Temperature,
+	}
+	if len(chatHistory) > 0 {
+		body["chat_history"] = chatHistory
+	}
+	if req.System != "" {
+		body["preamble"] = req.System
+	}
+	if req.Schema != nil {
+		body["response_format"] = map[string]interface{}{"type": "json_object", "schema": req.Schema.Schema}
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", req.URL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+req.APIKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+	return httpReq, nil
+}
+
+// ParseResponse reads the top-level text field and billed units of a Cohere chat response
+func (a *CohereAdapter) ParseResponse(body []byte) (*Completion, error) {
+	var result struct {
+		Text *string `json:"text"`
+		Meta struct {
+			BilledUnits struct {
+				InputTokens  int `json:"input_tokens"`
+				OutputTokens int `json:"output_tokens"`
+			} `json:"billed_units"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if result.Text == nil {
+		return nil, fmt.Errorf("invalid response: no text")
+	}
+
+	units := result.Meta.BilledUnits
+	return &Completion{
+		Content: *result.Text,
+		Usage: TokenUsage{
+			PromptTokens:     units.InputTokens,
+			CompletionTokens: units.OutputTokens,
+			TotalTokens:      units.InputTokens + units.OutputTokens,
+		},
+	}, nil
+}
+
+// cohereRole converts a chat role to the role names used in Cohere's chat_history
+func cohereRole(role string) string {
+	switch role {
+	case "assistant":
+		return "CHATBOT"
+	case "system":
+		return "SYSTEM"
+	default:
+		return "USER"
+	}
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCohereAdapterAgainstFakeServer(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer test-key" {
+			t.Errorf("Authorization = %q, want Bearer test-key", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"text":"Use a with statement.","meta":{"billed_units":{"input_tokens":12,"output_tokens":5}}}`)
+	}))
+	defer server.Close()
+
+	adapter := &CohereAdapter{}
+	httpReq, err := adapter.BuildRequest(context.Background(), &CompletionRequest{
+		Provider: "cohere",
+		URL:      server.URL,
+		APIKey:   "test-key",
+		Model:    "command-r",
+		System:   "You are a tutor.",
+		History: []ChatMessage{
+			{Role: RoleUser, Content: "How do I open a file?"},
+			{Role: RoleAssistant, Content: "Call open()."},
+		},
+		Prompt:      "And close it?",
+		Temperature: 0.5,
+	})
+	if err != nil {
+		t.Fatalf("BuildRequest: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		t.Fatalf("request to fake server failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+
+	if got["preamble"] != "You are a tutor." {
+		t.Errorf("preamble = %v, want the system prompt", got["preamble"])
+	}
+	if got["message"] != "And close it?" {
+		t.Errorf("message = %v, want the current prompt", got["message"])
+	}
+	history, _ := got["chat_history"].([]interface{})
+	wantHistory := []struct{ role, message string }{
+		{"USER", "How do I open a file?"},
+		{"CHATBOT", "Call open()."},
+	}
+	if len(history) != len(wantHistory) {
+		t.Fatalf("chat_history = %v, want %d turns", got["chat_history"], len(wantHistory))
+	}
+	for i, want := range wantHistory {
+		turn, _ := history[i].(map[string]interface{})
+		if turn["role"] != want.role || turn["message"] != want.message {
+			t.Errorf("chat_history[%d] = %v, want role %s and message %q", i, turn, want.role, want.message)
+		}
+	}
+
+	completion, err := adapter.ParseResponse(body)
+	if err != nil {
+		t.Fatalf("ParseResponse: %v", err)
+	}
+	if completion.Content != "Use a with statement." {
+		t.Errorf("Content = %q, want the text field", completion.Content)
+	}
+	wantUsage := TokenUsage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17}
+	if completion.Usage != wantUsage {
+		t.Errorf("Usage = %+v, want %+v", completion.Usage, wantUsage)
+	}
+}
@@ -1,12 +1,16 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"html"
+	"strings"
 	"time"
 
 	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/models"
-	_ "github.com/lib/pq" // PostgreSQL driver
+	"github.com/lib/pq" // PostgreSQL driver
 )
 
 // User represents a user in the system
@@ -22,6 +26,9 @@ type User struct {
 	LastLogin    time.Time
 }
 
+// ErrUserNotFound is returned when no user matches a username or ID
+var ErrUserNotFound = errors.New("user not found")
+
 // DBService holds the database connection
 type DBService struct {
 	db *sql.DB
@@ -39,6 +46,11 @@ func NewDBService(dsn string) (*DBService, error) {
 	return &DBService{db: db}, nil
 }
 
+// NewDBServiceWithDB wraps an already opened database, such as a test double
+func NewDBServiceWithDB(db *sql.DB) *DBService {
+	return &DBService{db: db}
+}
+
 // EmailExists checks if an email is already registered
 func (s *DBService) EmailExists(email string) (bool, error) {
 	var exists bool
@@ -132,7 +144,7 @@ func (s *DBService) GetUserCredentials(username string) (passwordHash, role stri
 		Scan(&passwordHash, &role)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", "", fmt.Errorf("user not found")
+			return "", "", ErrUserNotFound
 		}
 		return "", "", fmt.Errorf("database error: %v", err)
 	}
@@ -140,20 +152,748 @@ func (s *DBService) GetUserCredentials(username string) (passwordHash, role stri
 }
 
 // CreateQuery inserts a new query into the database
-func (s *DBService) CreateQuery(q *models.Query) error {
+func (s *DBService) CreateQuery(ctx context.Context, q *models.Query) error {
 	fmt.Printf("CreateQuery: q=%v\n", q)
-	_, err := s.db.Exec(
-		"INSERT INTO queries (id, query, provider_name, level, response, feedback) VALUES ($1, $2, $3, $4, $5, $6)",
-		q.ID, q.Query, q.Provider, q.Level, q.Response, q.Feedback,
+	service := q.Service
+	if service == "" {
+		service = "query"
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO queries (id, conversation_id, user_id, service, query, provider_name, model, level, prompt_version,
+		                     response, feedback, prompt_tokens, completion_tokens, total_tokens, latency_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		q.ID, q.ConversationID, q.UserID, service, q.Query, q.Provider, q.Model, q.Level, q.PromptVersion, q.Response, q.Feedback,
+		q.PromptTokens, q.CompletionTokens, q.TotalTokens, q.LatencyMs,
 	)
-	return err
+	if err != nil || q.ConversationID == nil {
+		return err
+	}
+
+	// Bump the thread and name it after its first query if it has no title yet
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE conversations
+		SET updated_at = CURRENT_TIMESTAMP,
+		    title = CASE WHEN title = '' THEN $2 ELSE title END
+		WHERE id = $1`,
+		*q.ConversationID, conversationTitle(q.Query),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update conversation: %v", err)
+	}
+	return nil
+}
+
+// ErrConversationNotFound is returned when a conversation ID does not exist
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// maxConversationTitleLength bounds titles derived from the first query of a thread
+const maxConversationTitleLength = 80
+
+// conversationTitle derives a thread title from the first line of a query
+func conversationTitle(query string) string {
+	title := strings.TrimSpace(strings.SplitN(strings.TrimSpace(query), "\n", 2)[0])
+	if runes := []rune(title); len(runes) > maxConversationTitleLength {
+		title = string(runes[:maxConversationTitleLength-3]) + "..."
+	}
+	return title
+}
+
+// CreateConversation starts a new, empty conversation thread owned by userID
+func (s *DBService) CreateConversation(ctx context.Context, userID int, title string) (*models.Conversation, error) {
+	var conv models.Conversation
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO conversations (user_id, title) VALUES ($1, $2)
+		RETURNING id, user_id, title, created_at, updated_at
+	`, userID, title).Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.CreatedAt, &conv.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create conversation: %v", err)
+	}
+	return &conv, nil
+}
+
+// ListConversations returns the conversation threads of a user, most recently active first
+func (s *DBService) ListConversations(ctx context.Context, userID int) ([]models.Conversation, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, title, created_at, updated_at
+		FROM conversations
+		WHERE user_id = $1
+		ORDER BY updated_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %v", err)
+	}
+	defer rows.Close()
+
+	conversations := []models.Conversation{}
+	for rows.Next() {
+		var conv models.Conversation
+		if err := rows.Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.CreatedAt, &conv.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %v", err)
+		}
+		conversations = append(conversations, conv)
+	}
+	return conversations, rows.Err()
+}
+
+// GetConversation retrieves a conversation thread by ID
+func (s *DBService) GetConversation(ctx context.Context, id string) (*models.Conversation, error) {
+	var conv models.Conversation
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, user_id, title, created_at, updated_at
+		FROM conversations
+		WHERE id = $1
+	`, id).Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.CreatedAt, &conv.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrConversationNotFound
+		}
+		return nil, fmt.Errorf("failed to get conversation: %v", err)
+	}
+	return &conv, nil
+}
+
+// RenameConversation changes the title of a conversation thread
+func (s *DBService) RenameConversation(ctx context.Context, id, title string) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE conversations SET title = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2",
+		title, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to rename conversation: %v", err)
+	}
+	return requireAffectedRow(result, ErrConversationNotFound)
+}
+
+// DeleteConversation deletes a conversation thread together with its queries
+func (s *DBService) DeleteConversation(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM conversations WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation: %v", err)
+	}
+	return requireAffectedRow(result, ErrConversationNotFound)
+}
+
+// GetConversationQueries returns the latest queries of a conversation thread, oldest first.
+// A limit of zero returns the whole thread.
+func (s *DBService) GetConversationQueries(ctx context.Context, conversationID string, limit int) ([]models.Query, error) {
+	query := `
+		SELECT id, user_id, query, provider_name, COALESCE(model, ''), level, response, feedback, created_at
+		FROM queries
+		WHERE conversation_id = $1
+		ORDER BY created_at DESC`
+	args := []interface{}{conversationID}
+	if limit > 0 {
+		query += " LIMIT $2"
+		args = append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation queries: %v", err)
+	}
+	defer rows.Close()
+
+	queries := []models.Query{}
+	for rows.Next() {
+		q := models.Query{ConversationID: &conversationID, Service: "query"}
+		if err := rows.Scan(&q.ID, &q.UserID, &q.Query, &q.Provider, &q.Model, &q.Level, &q.Response, &q.Feedback, &q.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation query: %v", err)
+		}
+		queries = append(queries, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get conversation queries: %v", err)
+	}
+
+	// Newest first was only needed for the limit
+	for i, j := 0, len(queries)-1; i < j; i, j = i+1, j-1 {
+		queries[i], queries[j] = queries[j], queries[i]
+	}
+	return queries, nil
+}
+
+// requireAffectedRow returns notFound when a statement did not touch any row
+func requireAffectedRow(result sql.Result, notFound error) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check affected rows: %v", err)
+	}
+	if affected == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// ErrQueryNotFound is returned when a query ID does not exist
+var ErrQueryNotFound = errors.New("query not found")
+
+// queryColumns lists the columns read by scanQuery
+const queryColumns = `id, conversation_id, user_id, service, query, provider_name, COALESCE(model, ''), level, prompt_version,
+	response, feedback, prompt_tokens, completion_tokens, total_tokens, latency_ms, created_at`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanQuery reads a query row selected with queryColumns
+func scanQuery(row rowScanner) (*models.Query, error) {
+	var q models.Query
+	err := row.Scan(&q.ID, &q.ConversationID, &q.UserID, &q.Service, &q.Query, &q.Provider, &q.Model, &q.Level, &q.PromptVersion, &q.Response,
+		&q.Feedback, &q.PromptTokens, &q.CompletionTokens, &q.TotalTokens, &q.LatencyMs, &q.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// GetQuery retrieves a stored query by ID
+func (s *DBService) GetQuery(ctx context.Context, id string) (*models.Query, error) {
+	q, err := scanQuery(s.db.QueryRowContext(ctx, "SELECT "+queryColumns+" FROM queries WHERE id = $1", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrQueryNotFound
+		}
+		return nil, fmt.Errorf("failed to get query: %v", err)
+	}
+	return q, nil
+}
+
+// HistoryCursor marks the last query of a history page; the next page starts right after it
+type HistoryCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// HistoryFilter selects the queries returned by ListQueries. Empty fields do not filter.
+type HistoryFilter struct {
+	UserID   int
+	Service  string
+	Level    string
+	Provider string
+	Feedback string // "positive", "negative", "neutral" or "none" for queries without feedback
+	From     *time.Time
+	To       *time.Time // Exclusive
+	Cursor   *HistoryCursor
+	Limit    int
+}
+
+// cursorTimeLayout keeps the microsecond precision of Postgres timestamps in cursors
+const cursorTimeLayout = "2006-01-02 15:04:05.999999"
+
+// ListQueries returns a page of a user's queries, newest first
+func (s *DBService) ListQueries(ctx context.Context, filter HistoryFilter) ([]models.Query, error) {
+	conditions := []string{"user_id = $1"}
+	args := []interface{}{filter.UserID}
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Service != "" {
+		addCondition("service = $%d", filter.Service)
+	}
+	if filter.Level != "" {
+		addCondition("level = $%d", filter.Level)
+	}
+	if filter.Provider != "" {
+		addCondition("provider_name = $%d", filter.Provider)
+	}
+	switch filter.Feedback {
+	case "":
+	case "none":
+		conditions = append(conditions, "feedback IS NULL")
+	default:
+		addCondition("feedback = $%d", filter.Feedback)
+	}
+	if filter.From != nil {
+		addCondition("created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		addCondition("created_at < $%d", *filter.To)
+	}
+	if filter.Cursor != nil {
+		args = append(args, filter.Cursor.CreatedAt.Format(cursorTimeLayout), filter.Cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < ($%d::timestamp, $%d::uuid)", len(args)-1, len(args)))
+	}
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM queries
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d
+	`, queryColumns, strings.Join(conditions, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queries: %v", err)
+	}
+	defer rows.Close()
+
+	queries := []models.Query{}
+	for rows.Next() {
+		q, err := scanQuery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan query: %v", err)
+		}
+		queries = append(queries, *q)
+	}
+	return queries, rows.Err()
+}
+
+// ExportFilter selects the queries passed to ForEachQuery. Empty fields do not filter.
+type ExportFilter struct {
+	QueryID        string
+	ConversationID string
+	UserID         *int
+	From           *time.Time
+	To             *time.Time // Exclusive
+}
+
+// ForEachQuery streams the matching queries to fn, oldest first, without loading them all into memory
+func (s *DBService) ForEachQuery(ctx context.Context, filter ExportFilter, fn func(*models.Query) error) error {
+	conditions := []string{"TRUE"}
+	args := []interface{}{}
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.QueryID != "" {
+		addCondition("id = $%d", filter.QueryID)
+	}
+	if filter.ConversationID != "" {
+		addCondition("conversation_id = $%d", filter.ConversationID)
+	}
+	if filter.UserID != nil {
+		addCondition("user_id = $%d", *filter.UserID)
+	}
+	if filter.From != nil {
+		addCondition("created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		addCondition("created_at < $%d", *filter.To)
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM queries
+		WHERE %s
+		ORDER BY created_at, id
+	`, queryColumns, strings.Join(conditions, " AND ")), args...)
+	if err != nil {
+		return fmt.Errorf("failed to export queries: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		q, err := scanQuery(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan query: %v", err)
+		}
+		if err := fn(q); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// SearchFilter selects the queries matched by SearchQueries
+type SearchFilter struct {
+	Text    string // Web-search style terms, e.g. "goroutine leak" or "channel -buffered"
+	UserID  *int   // Only search this user's queries; nil searches everyone's
+	Service string
+	Limit   int
+	Offset  int
+}
+
+// SearchResult is a query matched by a full-text search with its rank and HTML-escaped, highlighted snippets
+type SearchResult struct {
+	models.Query
+	Rank            float64
+	QuerySnippet    string
+	ResponseSnippet string
+}
+
+// Private-use characters that ts_headline puts around matches; they become <mark> tags once the
+// snippet has been HTML-escaped, so stored text can never inject markup
+const (
+	searchMarkStart = "\uE000"
+	searchMarkStop  = "\uE001"
+)
+
+// searchHeadlineOptions marks matches with the sentinel characters and keeps snippets short
+const searchHeadlineOptions = "StartSel=" + searchMarkStart + ", StopSel=" + searchMarkStop +
+	", MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=\" ... \""
+
+// searchHighlighter turns the sentinel characters of an escaped snippet into <mark> tags
+var searchHighlighter = strings.NewReplacer(searchMarkStart, "<mark>", searchMarkStop, "</mark>")
+
+// highlightSnippet HTML-escapes a ts_headline snippet and wraps its matches in <mark>
+func highlightSnippet(snippet string) string {
+	return searchHighlighter.Replace(html.EscapeString(snippet))
+}
+
+// SearchQueries runs a ranked full-text search over stored questions and answers
+func (s *DBService) SearchQueries(ctx context.Context, filter SearchFilter) ([]SearchResult, error) {
+	conditions := []string{"search_vector @@ websearch_to_tsquery('english', $1)"}
+	args := []interface{}{filter.Text, searchHeadlineOptions}
+	if filter.UserID != nil {
+		args = append(args, *filter.UserID)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if filter.Service != "" {
+		args = append(args, filter.Service)
+		conditions = append(conditions, fmt.Sprintf("service = $%d", len(args)))
+	}
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s,
+		       ts_rank_cd(search_vector, websearch_to_tsquery('english', $1)) AS rank,
+		       ts_headline('english', query, websearch_to_tsquery('english', $1), $2),
+		       ts_headline('english', response, websearch_to_tsquery('english', $1), $2)
+		FROM queries
+		WHERE %s
+		ORDER BY rank DESC, created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, queryColumns, strings.Join(conditions, " AND "), len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search queries: %v", err)
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var r SearchResult
+		q := &r.Query
+		err := rows.Scan(&q.ID, &q.ConversationID, &q.UserID, &q.Service, &q.Query, &q.Provider, &q.Model, &q.Level, &q.PromptVersion, &q.Response,
+			&q.Feedback, &q.PromptTokens, &q.CompletionTokens, &q.TotalTokens, &q.LatencyMs, &q.CreatedAt,
+			&r.Rank, &r.QuerySnippet, &r.ResponseSnippet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %v", err)
+		}
+		r.QuerySnippet = highlightSnippet(r.QuerySnippet)
+		r.ResponseSnippet = highlightSnippet(r.ResponseSnippet)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// UsageStat aggregates token consumption and latency for one service, provider, model and user
+type UsageStat struct {
+	Service          string  `json:"service"`
+	Provider         string  `json:"provider"`
+	Model            string  `json:"model"`
+	UserID           *int    `json:"user_id"`  // Nil for anonymous calls
+	Username         *string `json:"username"` // Nil for anonymous calls
+	Requests         int     `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+}
+
+// GetUsageStats aggregates AI usage recorded since the given time, optionally restricted to one user
+func (s *DBService) GetUsageStats(ctx context.Context, since time.Time, userID *int) ([]UsageStat, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT q.service, q.provider_name, COALESCE(q.model, ''), q.user_id, u.username, COUNT(*),
+		       SUM(q.prompt_tokens), SUM(q.completion_tokens), SUM(q.total_tokens), AVG(q.latency_ms)
+		FROM queries q
+		LEFT JOIN users u ON u.id = q.user_id
+		WHERE q.created_at >= $1 AND ($2::int IS NULL OR q.user_id = $2)
+		GROUP BY q.service, q.provider_name, COALESCE(q.model, ''), q.user_id, u.username
+		ORDER BY SUM(q.total_tokens) DESC
+	`, since, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage stats: %v", err)
+	}
+	defer rows.Close()
+
+	stats := []UsageStat{}
+	for rows.Next() {
+		var stat UsageStat
+		if err := rows.Scan(&stat.Service, &stat.Provider, &stat.Model, &stat.UserID, &stat.Username, &stat.Requests,
+			&stat.PromptTokens, &stat.CompletionTokens, &stat.TotalTokens, &stat.AvgLatencyMs); err != nil {
+			return nil, fmt.Errorf("failed to scan usage stat: %v", err)
+		}
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+// feedbackDimensions maps the supported grouping keys of GetFeedbackStats to their SQL expressions
+var feedbackDimensions = map[string]string{
+	"service":        "q.service",
+	"level":          "q.level",
+	"provider":       "q.provider_name",
+	"model":          "COALESCE(q.model, '')",
+	"prompt_version": "q.prompt_version",
+}
+
+// IsFeedbackDimension reports whether key can be used to group feedback stats
+func IsFeedbackDimension(key string) bool {
+	_, ok := feedbackDimensions[key]
+	return ok
+}
+
+// FeedbackStat aggregates the feedback on answers for one group and time bucket.
+// Only the fields of the requested dimensions are set.
+type FeedbackStat struct {
+	Bucket        *time.Time `json:"bucket,omitempty"`
+	Service       *string    `json:"service,omitempty"`
+	Level         *string    `json:"level,omitempty"`
+	Provider      *string    `json:"provider,omitempty"`
+	Model         *string    `json:"model,omitempty"`
+	PromptVersion *string    `json:"prompt_version,omitempty"`
+	Answers       int        `json:"answers"`
+	Positive      int        `json:"positive"`
+	Negative      int        `json:"negative"`
+	Neutral       int        `json:"neutral"`
+	PositiveRatio *float64   `json:"positive_ratio,omitempty"` // positive / (positive + negative), omitted without votes
+	Ratings       int        `json:"ratings"`
+	AvgRating     *float64   `json:"avg_rating,omitempty"`
+}
+
+// GetFeedbackStats aggregates votes and ratings on answers given since the given time, grouped by the
+// dimensions in groupBy and, unless bucket is empty, by "day", "week" or "month" of the answer
+func (s *DBService) GetFeedbackStats(ctx context.Context, since time.Time, groupBy []string, bucket string) ([]FeedbackStat, error) {
+	var columns []string
+	var stat FeedbackStat
+	targets := map[string]interface{}{
+		"service":        &stat.Service,
+		"level":          &stat.Level,
+		"provider":       &stat.Provider,
+		"model":          &stat.Model,
+		"prompt_version": &stat.PromptVersion,
+	}
+	var dest []interface{}
+	switch bucket {
+	case "":
+	case "day", "week", "month":
+		columns = append(columns, fmt.Sprintf("date_trunc('%s', q.created_at)", bucket))
+		dest = append(dest, &stat.Bucket)
+	default:
+		return nil, fmt.Errorf("unknown feedback bucket: %s", bucket)
+	}
+	for _, key := range groupBy {
+		expr, ok := feedbackDimensions[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown feedback dimension: %s", key)
+		}
+		columns = append(columns, expr)
+		dest = append(dest, targets[key])
+	}
+	var positiveRatio sql.NullFloat64
+	var avgRating sql.NullFloat64
+	dest = append(dest, &stat.Answers, &stat.Positive, &stat.Negative, &stat.Neutral, &stat.Ratings, &avgRating, &positiveRatio)
+
+	groupClause := ""
+	if len(columns) > 0 {
+		groupClause = "GROUP BY " + strings.Join(columns, ", ") + "\n\t\tORDER BY " + strings.Join(columns, ", ")
+		columns = append(columns, "")
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		       COUNT(DISTINCT q.id),
+		       COUNT(f.id) FILTER (WHERE f.vote = 'positive'),
+		       COUNT(f.id) FILTER (WHERE f.vote = 'negative'),
+		       COUNT(f.id) FILTER (WHERE f.vote = 'neutral'),
+		       COUNT(f.rating),
+		       AVG(f.rating),
+		       COUNT(f.id) FILTER (WHERE f.vote = 'positive')::float
+		           / NULLIF(COUNT(f.id) FILTER (WHERE f.vote IN ('positive', 'negative')), 0)
+		FROM queries q
+		LEFT JOIN feedback f ON f.query_id = q.id AND f.suggestion_id IS NULL
+		WHERE q.created_at >= $1
+		%s
+	`, strings.Join(columns, ", "), groupClause), since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feedback stats: %v", err)
+	}
+	defer rows.Close()
+
+	stats := []FeedbackStat{}
+	for rows.Next() {
+		stat = FeedbackStat{}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan feedback stat: %v", err)
+		}
+		if avgRating.Valid {
+			stat.AvgRating = &avgRating.Float64
+		}
+		if positiveRatio.Valid {
+			stat.PositiveRatio = &positiveRatio.Float64
+		}
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+// RatedAnswer is an answer with the aggregate of the feedback it received
+type RatedAnswer struct {
+	models.Query
+	Score     float64  // Mean of the ratings, with votes counted as 5 (positive), 3 (neutral) or 1 (negative)
+	Feedbacks int      // Number of feedback entries
+	Negative  int      // Number of negative votes
+	Reasons   []string // Distinct reason tags
+	Comments  []string // Non-empty comments, newest first
+}
+
+// GetWorstRatedAnswers returns the answers given since the given time with the lowest feedback score
+func (s *DBService) GetWorstRatedAnswers(ctx context.Context, since time.Time, limit int) ([]RatedAnswer, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT q.id, q.conversation_id, q.user_id, q.service, q.query, q.provider_name, COALESCE(q.model, ''), q.level,
+		       q.prompt_version, q.response, q.feedback, q.prompt_tokens, q.completion_tokens, q.total_tokens, q.latency_ms,
+		       q.created_at,
+		       AVG(COALESCE(f.rating, CASE f.vote WHEN 'positive' THEN 5 WHEN 'neutral' THEN 3 WHEN 'negative' THEN 1 END)) AS score,
+		       COUNT(f.id),
+		       COUNT(f.id) FILTER (WHERE f.vote = 'negative'),
+		       ARRAY(SELECT DISTINCT r FROM feedback rf, unnest(rf.reasons) r
+		             WHERE rf.query_id = q.id AND rf.suggestion_id IS NULL ORDER BY r),
+		       COALESCE(array_agg(f.comment ORDER BY f.updated_at DESC) FILTER (WHERE f.comment IS NOT NULL), '{}')
+		FROM queries q
+		JOIN feedback f ON f.query_id = q.id AND f.suggestion_id IS NULL
+		WHERE q.created_at >= $1
+		GROUP BY q.id
+		HAVING AVG(COALESCE(f.rating, CASE f.vote WHEN 'positive' THEN 5 WHEN 'neutral' THEN 3 WHEN 'negative' THEN 1 END)) IS NOT NULL
+		ORDER BY score ASC, COUNT(f.id) FILTER (WHERE f.vote = 'negative') DESC, q.created_at DESC
+		LIMIT $2
+	`, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worst rated answers: %v", err)
+	}
+	defer rows.Close()
+
+	answers := []RatedAnswer{}
+	for rows.Next() {
+		var a RatedAnswer
+		q := &a.Query
+		err := rows.Scan(&q.ID, &q.ConversationID, &q.UserID, &q.Service, &q.Query, &q.Provider, &q.Model, &q.Level,
+			&q.PromptVersion, &q.Response, &q.Feedback, &q.PromptTokens, &q.CompletionTokens, &q.TotalTokens, &q.LatencyMs,
+			&q.CreatedAt, &a.Score, &a.Feedbacks, &a.Negative, pq.Array(&a.Reasons), pq.Array(&a.Comments))
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rated answer: %v", err)
+		}
+		answers = append(answers, a)
+	}
+	return answers, rows.Err()
+}
+
+// GetCachedResponse returns the unexpired cache entry for a key, or nil when there is none
+func (s *DBService) GetCachedResponse(ctx context.Context, key string) (*CachedResponse, error) {
+	var entry CachedResponse
+	err := s.db.QueryRowContext(ctx, `
+		SELECT service, provider_name, COALESCE(model, ''), response, expires_at
+		FROM response_cache
+		WHERE cache_key = $1 AND expires_at > CURRENT_TIMESTAMP
+	`, key).Scan(&entry.Service, &entry.Provider, &entry.Model, &entry.Content, &entry.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get cached response: %v", err)
+	}
+	return &entry, nil
 }
 
-// UpdateFeedback updates the feedback for a given query ID
-func (s *DBService) UpdateFeedback(id, feedback string) error {
-	fmt.Printf("UpdateFeedback: id=%s, feedback=%s\n", id, feedback)
-	_, err := s.db.Exec("UPDATE queries SET feedback = $1 WHERE id = $2", feedback, id)
-	return err
+// UpsertCachedResponse stores or refreshes a cache entry
+func (s *DBService) UpsertCachedResponse(ctx context.Context, key string, entry *CachedResponse) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO response_cache (cache_key, service, provider_name, model, response, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (cache_key)
+		DO UPDATE SET response = $5, provider_name = $3, model = $4, expires_at = $6, created_at = CURRENT_TIMESTAMP
+	`, key, entry.Service, entry.Provider, entry.Model, entry.Content, entry.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to store cached response: %v", err)
+	}
+	return nil
+}
+
+// PurgeCachedResponses deletes the cache entries of a service, or all entries when service is empty
+func (s *DBService) PurgeCachedResponses(ctx context.Context, service string) error {
+	var err error
+	if service == "" {
+		_, err = s.db.ExecContext(ctx, "DELETE FROM response_cache")
+	} else {
+		_, err = s.db.ExecContext(ctx, "DELETE FROM response_cache WHERE service = $1", service)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to purge cached responses: %v", err)
+	}
+	return nil
+}
+
+// ErrSuggestionNotFound is returned when a suggestion ID does not belong to the given query
+var ErrSuggestionNotFound = errors.New("suggestion not found")
+
+// CreateSuggestions stores the suggestions of an analyze call and fills in their IDs
+func (s *DBService) CreateSuggestions(ctx context.Context, suggestions []models.Suggestion) error {
+	for i := range suggestions {
+		sg := &suggestions[i]
+		err := s.db.QueryRowContext(ctx, `
+			INSERT INTO suggestions (query_id, position, line, message, details)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`, sg.QueryID, sg.Position, sg.Line, sg.Message, []byte(sg.Details)).Scan(&sg.ID)
+		if err != nil {
+			return fmt.Errorf("failed to store suggestion: %v", err)
+		}
+	}
+	return nil
+}
+
+// SubmitFeedback records feedback on an answer or one of its suggestions. Signed-in users update their
+// earlier feedback on the same target. A vote on the whole answer is also kept in queries.feedback.
+func (s *DBService) SubmitFeedback(ctx context.Context, fb *models.Feedback) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if fb.SuggestionID != nil {
+		var exists bool
+		err := tx.QueryRowContext(ctx,
+			"SELECT EXISTS(SELECT 1 FROM suggestions WHERE id = $1 AND query_id = $2)",
+			*fb.SuggestionID, fb.QueryID,
+		).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check suggestion: %v", err)
+		}
+		if !exists {
+			return ErrSuggestionNotFound
+		}
+	}
+
+	reasons := fb.Reasons
+	if reasons == nil {
+		reasons = []string{}
+	}
+	query := `
+		INSERT INTO feedback (query_id, suggestion_id, user_id, vote, rating, comment, reasons)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	if fb.UserID != nil {
+		query += `
+		ON CONFLICT (query_id, COALESCE(suggestion_id, 0), user_id) WHERE user_id IS NOT NULL
+		DO UPDATE SET vote = $4, rating = $5, comment = $6, reasons = $7, updated_at = CURRENT_TIMESTAMP`
+	}
+	err = tx.QueryRowContext(ctx, query+" RETURNING id",
+		fb.QueryID, fb.SuggestionID, fb.UserID, fb.Vote, fb.Rating, fb.Comment, pq.Array(reasons),
+	).Scan(&fb.ID)
+	if err != nil {
+		return fmt.Errorf("failed to store feedback: %v", err)
+	}
+
+	if fb.SuggestionID == nil && fb.Vote != nil {
+		if _, err := tx.ExecContext(ctx, "UPDATE queries SET feedback = $1 WHERE id = $2", *fb.Vote, fb.QueryID); err != nil {
+			return fmt.Errorf("failed to update query feedback: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit feedback: %v", err)
+	}
+	return nil
 }
 
 // GetUserProfile retrieves the user's profile information
@@ -177,7 +917,7 @@ func (s *DBService) GetUserProfile(username string) (*User, error) {
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("failed to get user profile: %v", err)
 	}
@@ -244,8 +984,12 @@ func (s *DBService) UpdateUserRole(userID int, role string) error {
 
 // DeleteUser deletes a user by ID
 func (s *DBService) DeleteUser(userID int) error {
-	// First delete any related data (queries, feedback, etc.)
-	_, err := s.db.Exec("DELETE FROM queries WHERE user_id = $1", userID)
+	// First delete any related data (conversations, queries, feedback, etc.)
+	_, err := s.db.Exec("DELETE FROM conversations WHERE user_id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user conversations: %v", err)
+	}
+	_, err = s.db.Exec("DELETE FROM queries WHERE user_id = $1", userID)
 	if err != nil {
 		return fmt.Errorf("failed to delete user queries: %v", err)
 	}
@@ -270,6 +1014,46 @@ func (s *DBService) UpdateLastLogin(username string) error {
 	return nil
 }
 
+// SetUserAPIToken stores the hash of a new personal API token, replacing any previous token
+func (s *DBService) SetUserAPIToken(username, tokenHash string) error {
+	_, err := s.db.Exec(
+		"UPDATE users SET api_token_hash = $1, api_token_created_at = CURRENT_TIMESTAMP WHERE username = $2",
+		tokenHash, username,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set API token: %v", err)
+	}
+	return nil
+}
+
+// RevokeUserAPIToken removes a user's personal API token
+func (s *DBService) RevokeUserAPIToken(username string) error {
+	_, err := s.db.Exec(
+		"UPDATE users SET api_token_hash = NULL, api_token_created_at = NULL WHERE username = $1",
+		username,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API token: %v", err)
+	}
+	return nil
+}
+
+// GetUserByAPITokenHash returns the user a personal API token belongs to, or nil when the token is unknown
+func (s *DBService) GetUserByAPITokenHash(ctx context.Context, tokenHash string) (*User, error) {
+	var user User
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, username, role FROM users WHERE api_token_hash = $1",
+		tokenHash,
+	).Scan(&user.ID, &user.Username, &user.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user by API token: %v", err)
+	}
+	return &user, nil
+}
+
 // GetUserByID retrieves a user by their ID
 func (s *DBService) GetUserByID(userID int) (*User, error) {
 	var user User
@@ -291,7 +1075,7 @@ func (s *DBService) GetUserByID(userID int) (*User, error) {
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("failed to get user by ID: %v", err)
 	}
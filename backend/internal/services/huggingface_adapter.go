@@ -0,0 +1,74 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const huggingFaceDefaultMaxNewTokens = 1024
+
+// HuggingFaceAdapter speaks the Hugging Face Inference API for text-generation models
+type HuggingFaceAdapter struct{}
+
+// BuildRequest flattens the conversation into a single inputs string with generation parameters
+func (a *HuggingFaceAdapter) BuildRequest(ctx context.Context, req *CompletionRequest) (*http.Request, error) {
+	var inputs strings.Builder
+	if req.System != "" {
+		inputs.WriteString(req.System)
+		inputs.WriteString("\n\n")
+	}
+	for _, msg := range req.History {
+		inputs.WriteString(msg.Role)
+		inputs.WriteString(": ")
+		inputs.WriteString(msg.Content)
+		inputs.WriteString("\n")
+	}
+	inputs.WriteString(req.Prompt)
+
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"inputs": inputs.String(),
+		"parameters": map[string]interface{}{
+			"temperature":      req.Temperature,
+			"max_new_tokens":   huggingFaceDefaultMaxNewTokens,
+			"return_full_text": false,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", req.URL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+req.APIKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+	return httpReq, nil
+}
+
+// ParseResponse reads generated_text from the array returned by text-generation models.
+// The Inference API does not report token usage.
+func (a *HuggingFaceAdapter) ParseResponse(body []byte) (*Completion, error) {
+	var results []struct {
+		GeneratedText *string `json:"generated_text"`
+	}
+	if err := json.Unmarshal(body, &results); err != nil {
+		// Errors such as a model still loading are returned as an object
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		if jsonErr := json.Unmarshal(body, &errResp); jsonErr == nil && errResp.Error != "" {
+			return nil, fmt.Errorf("AI service error: %s", errResp.Error)
+		}
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(results) == 0 || results[0].GeneratedText == nil {
+		return nil, fmt.Errorf("invalid response: no generated_text")
+	}
+	return &Completion{Content: *results[0].GeneratedText}, nil
+}
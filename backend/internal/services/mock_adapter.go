@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockSettings scripts the behaviour of the built-in mock provider
+type MockSettings struct {
+	Mode           string         `json:"mode,omitempty"`             // "echo" (default) or "analyze" for canned suggestions
+	Responses      []MockResponse `json:"responses,omitempty"`        // Scripted answers, first match wins
+	LatencyMs      int            `json:"latency_ms,omitempty"`       // Simulated response time
+	FailEvery      int            `json:"fail_every,omitempty"`       // Every Nth call fails with a 500
+	RateLimitEvery int            `json:"rate_limit_every,omitempty"` // Every Nth call fails with a 429
+	RetryAfterSecs int            `json:"retry_after_seconds,omitempty"`
+}
+
+// MockResponse is a scripted answer returned when the prompt contains Match
+type MockResponse struct {
+	Match    string `json:"match"`
+	Response string `json:"response"`
+}
+
+// MockAdapter answers in-process with deterministic responses so the backend runs without a network or API key.
+// The calls counted for fail_every and rate_limit_every are kept per provider entry, so services and
+// fallbacks do not affect each other. Every attempt counts, including retries, and the counters start
+// over whenever the settings are reloaded.
+type MockAdapter struct {
+	mu    sync.Mutex
+	calls map[*MockSettings]int
+}
+
+// Reset starts the call counters of every mock entry over
+func (a *MockAdapter) Reset() {
+	a.mu.Lock()
+	a.calls = nil
+	a.mu.Unlock()
+}
+
+// BuildRequest is never sent; the mock answers through Complete
+func (a *MockAdapter) BuildRequest(ctx context.Context, req *CompletionRequest) (*http.Request, error) {
+	return nil, fmt.Errorf("mock provider does not make HTTP requests")
+}
+
+// ParseResponse returns the body unchanged
+func (a *MockAdapter) ParseResponse(body []byte) (*Completion, error) {
+	return &Completion{Content: string(body)}, nil
+}
+
+// Complete produces the scripted, canned or echoed response after the simulated latency
+func (a *MockAdapter) Complete(ctx context.Context, req *CompletionRequest) (*Completion, error) {
+	settings := req.Mock
+	if settings == nil {
+		settings = &MockSettings{}
+	}
+
+	// Entries without mock settings have no failure modes and need no counter
+	call := 0
+	if req.Mock != nil {
+		a.mu.Lock()
+		if a.calls == nil {
+			a.calls = make(map[*MockSettings]int)
+		}
+		a.calls[req.Mock]++
+		call = a.calls[req.Mock]
+		a.mu.Unlock()
+	}
+
+	if settings.LatencyMs > 0 {
+		select {
+		case <-time.After(time.Duration(settings.LatencyMs) * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if settings.RateLimitEvery > 0 && call%settings.RateLimitEvery == 0 {
+		return nil, &ProviderError{
+			Provider:   req.Provider,
+			StatusCode: http.StatusTooManyRequests,
+			Body:       `{"error":"mock rate limit"}`,
+			RetryAfter: time.Duration(settings.RetryAfterSecs) * time.Second,
+		}
+	}
+	if settings.FailEvery > 0 && call%settings.FailEvery == 0 {
+		return nil, &ProviderError{
+			Provider:   req.Provider,
+			StatusCode: http.StatusInternalServerError,
+			Body:       `{"error":"mock failure"}`,
+		}
+	}
+
+	content := mockContent(settings, req.Prompt, req.Schema != nil)
+	promptTokens := len(strings.Fields(req.System + " " + req.Prompt))
+	completionTokens := len(strings.Fields(content))
+	return &Completion{
+		Content: content,
+		Usage: TokenUsage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		},
+	}, nil
+}
+
+// mockContent picks the scripted answer matching the prompt, or falls back to the mode's default.
+// In analyze mode, structured requests get the canned suggestions as JSON.
+func mockContent(settings *MockSettings, prompt string, structured bool) string {
+	for _, scripted := range settings.Responses {
+		if strings.Contains(prompt, scripted.Match) {
+			return scripted.Response
+		}
+	}
+
+	if settings.Mode == "analyze" && structured {
+		return `{"suggestions":[` +
+			`{"line":1,"end_line":1,"severity":"info","category":"readability","message":"Add a descriptive comment",` +
+			`"explanation":"The purpose of this code is not explained. Describe what the code does in a short comment."},` +
+			`{"line":1,"end_line":1,"severity":"hint","category":"style","message":"Use a more descriptive name",` +
+			`"explanation":"Short names make the code harder to follow. Rename identifiers to reflect their purpose."}]}`
+	}
+	if settings.Mode == "analyze" {
+		return "Line 1: Add a descriptive comment\n" +
+			"Problem: The purpose of this code is not explained.\n" +
+			"Suggestion: Describe what the code does in a short comment.\n\n" +
+			"Line 2: Use a more descriptive name\n" +
+			"Problem: Short names make the code harder to follow.\n" +
+			"Suggestion: Rename identifiers to reflect their purpose.\n"
+	}
+	return "Mock response: " + prompt
+}
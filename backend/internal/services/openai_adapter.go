@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// OpenAIAdapter speaks the OpenAI chat completions API, which is also used by Groq and most custom endpoints
+type OpenAIAdapter struct{}
+
+// BuildRequest creates an OpenAI-style chat completions request
+func (a *OpenAIAdapter) BuildRequest(ctx context.Context, req *CompletionRequest) (*http.Request, error) {
+	messages := []map[string]string{}
+	if req.System != "" {
+		messages = append(messages, map[string]string{"role": "system", "content": req.System})
+	}
+	for _, msg := range req.History {
+		messages = append(messages, map[string]string{"role": msg.Role, "content": msg.Content})
+	}
+	messages = append(messages, map[string]string{"role": "user", "content": req.Prompt})
+
+	body := map[string]interface{}{
+		"model":       req.Model,
+		"temperature": req.Temperature,
+		"messages":    messages,
+	}
+	if req.Stream {
+		body["stream"] = true
+		body["stream_options"] = map[string]bool{"include_usage": true}
+	}
+	// JSON mode is understood by OpenAI, Azure, Groq and most local servers; the schema itself is in the prompt
+	if req.Schema != nil {
+		body["response_format"] = map[string]string{"type": "json_object"}
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", req.URL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	// Local servers usually run without authentication
+	if req.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+req.APIKey)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	return httpReq, nil
+}
+
+// ParseResponse reads choices[0].message.content and the usage block from an OpenAI-style response
+func (a *OpenAIAdapter) ParseResponse(body []byte) (*Completion, error) {
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content *string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage TokenUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(result.Choices) == 0 {
+		return nil, fmt.Errorf("invalid response: no choices")
+	}
+	content := result.Choices[0].Message.Content
+	if content == nil {
+		return nil, fmt.Errorf("content not a string")
+	}
+	return &Completion{Content: *content, Usage: result.Usage}, nil
+}
+
+// ParseStreamEvent reads choices[0].delta.content from a streamed chunk; "[DONE]" ends the stream.
+// Usage arrives in a final chunk (or x_groq for Groq) when include_usage is requested.
+func (a *OpenAIAdapter) ParseStreamEvent(data []byte) (*StreamEvent, error) {
+	if string(data) == "[DONE]" {
+		return &StreamEvent{Done: true}, nil
+	}
+
+	var chunk struct {
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+		} `json:"choices"`
+		Usage *TokenUsage `json:"usage"`
+		XGroq *struct {
+			Usage *TokenUsage `json:"usage"`
+		} `json:"x_groq"`
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return nil, fmt.Errorf("failed to decode stream chunk: %w", err)
+	}
+
+	event := &StreamEvent{Usage: chunk.Usage}
+	if event.Usage == nil && chunk.XGroq != nil {
+		event.Usage = chunk.XGroq.Usage
+	}
+	if len(chunk.Choices) > 0 {
+		event.Delta = chunk.Choices[0].Delta.Content
+	}
+	return event, nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"net/http"
+)
+
+// Chat message roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// ChatMessage is a single message of a conversation
+type ChatMessage struct {
+	Role    string // RoleSystem, RoleUser or RoleAssistant
+	Content string
+}
+
+// CompletionRequest holds the provider-agnostic parameters of a completion call
+type CompletionRequest struct {
+	Provider    string
+	URL         string
+	APIKey      string
+	Model       string
+	System      string        // Optional system instructions
+	History     []ChatMessage // Optional prior conversation turns, oldest first
+	Prompt      string
+	Temperature float64
+	Stream      bool            // Request an incremental (SSE) response
+	Schema      *ResponseSchema // Request a JSON object matching this schema where the provider supports it
+	Mock        *MockSettings   // Behaviour of the mock provider
+}
+
+// ResponseSchema describes the JSON object a structured completion must return
+type ResponseSchema struct {
+	Name        string                 // Identifier, also used as the tool name for tool-calling providers
+	Description string                 // What the object contains
+	Schema      map[string]interface{} // JSON Schema of the object
+}
+
+// TokenUsage reports the tokens consumed by a completion call
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// add accumulates usage reported in several parts, as streaming APIs do
+func (u *TokenUsage) add(other TokenUsage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	if other.TotalTokens > 0 {
+		u.TotalTokens += other.TotalTokens
+	} else {
+		u.TotalTokens += other.PromptTokens + other.CompletionTokens
+	}
+}
+
+// Completion is the parsed result of a provider response
+type Completion struct {
+	Content string
+	Usage   TokenUsage
+}
+
+// StreamEvent is the parsed content of a single SSE data payload
+type StreamEvent struct {
+	Delta string      // Text fragment, empty for events without text
+	Done  bool        // The stream is finished
+	Usage *TokenUsage // Usage reported by this event, if any
+}
+
+// ProviderAdapter translates completion requests and responses to and from a provider's native API
+type ProviderAdapter interface {
+	// BuildRequest creates the HTTP request for the provider
+	BuildRequest(ctx context.Context, req *CompletionRequest) (*http.Request, error)
+	// ParseResponse extracts the completion text and token usage from the provider's response body
+	ParseResponse(body []byte) (*Completion, error)
+}
+
+// StreamingAdapter is implemented by adapters that can parse server-sent event streams
+type StreamingAdapter interface {
+	ProviderAdapter
+	// ParseStreamEvent extracts the text delta, usage and end-of-stream marker from a single SSE data payload
+	ParseStreamEvent(data []byte) (*StreamEvent, error)
+}
+
+// DirectAdapter is implemented by adapters that answer in-process instead of over HTTP
+type DirectAdapter interface {
+	Complete(ctx context.Context, req *CompletionRequest) (*Completion, error)
+}
+
+// providerAdapters maps provider names to their adapters.
+// Providers not listed here use the OpenAI-compatible adapter.
+var providerAdapters = map[string]ProviderAdapter{
+	"anthropic":    &AnthropicAdapter{},
+	"azure-openai": &AzureOpenAIAdapter{},
+	"cohere":       &CohereAdapter{},
+	"huggingface":  &HuggingFaceAdapter{},
+	"mock":         &MockAdapter{},
+}
+
+// GetProviderAdapter returns the adapter for a given provider
+func GetProviderAdapter(provider string) ProviderAdapter {
+	if adapter, ok := providerAdapters[provider]; ok {
+		return adapter
+	}
+	return &OpenAIAdapter{}
+}
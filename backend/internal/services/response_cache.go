@@ -0,0 +1,158 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheTTL      = time.Hour
+	defaultCacheCapacity = 1000
+)
+
+// CacheSettings controls the opt-in response cache of a service
+type CacheSettings struct {
+	Enabled    bool   `json:"enabled"`
+	TTLSeconds int    `json:"ttl_seconds,omitempty"` // How long an entry stays valid
+	Store      string `json:"store,omitempty"`       // "memory" (default) or "postgres" to share entries across instances
+}
+
+// ttl returns the configured lifetime of cache entries
+func (c *CacheSettings) ttl() time.Duration {
+	if c.TTLSeconds > 0 {
+		return time.Duration(c.TTLSeconds) * time.Second
+	}
+	return defaultCacheTTL
+}
+
+// CachedResponse is a stored AI answer
+type CachedResponse struct {
+	Service   string
+	Provider  string
+	Model     string
+	Content   string
+	ExpiresAt time.Time
+}
+
+// ResponseCache stores AI answers keyed by a hash of the request
+type ResponseCache interface {
+	Get(ctx context.Context, key string) (*CachedResponse, bool)
+	Set(ctx context.Context, key string, entry *CachedResponse) error
+	// Purge removes all entries of a service, or every entry when service is empty
+	Purge(ctx context.Context, service string) error
+}
+
+// responseCacheKey hashes everything that influences the answer of a completion call.
+// format is the name of the requested response schema, empty for free text.
+func responseCacheKey(service, provider, model string, temperature float64, format string, messages []ChatMessage) string {
+	h := sha256.New()
+	for _, part := range []string{service, provider, model, strconv.FormatFloat(temperature, 'f', -1, 64), format} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	for _, msg := range messages {
+		h.Write([]byte(msg.Role))
+		h.Write([]byte{0})
+		h.Write([]byte(msg.Content))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// memoryCache is an in-process LRU cache with per-entry expiry
+type memoryCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // Front is most recently used
+	entries  map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CachedResponse
+}
+
+// newMemoryCache creates an LRU cache holding at most capacity entries
+func newMemoryCache(capacity int) *memoryCache {
+	return &memoryCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	item := elem.Value.(*memoryCacheItem)
+	if time.Now().After(item.entry.ExpiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return item.entry, true
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, entry *CachedResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*memoryCacheItem).entry = entry
+		c.order.MoveToFront(elem)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryCacheItem{key: key, entry: entry})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+	return nil
+}
+
+func (c *memoryCache) Purge(ctx context.Context, service string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, elem := range c.entries {
+		if service == "" || elem.Value.(*memoryCacheItem).entry.Service == service {
+			c.order.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+	return nil
+}
+
+// postgresCache persists entries in the response_cache table so they survive restarts
+type postgresCache struct {
+	dbService *DBService
+}
+
+func (c *postgresCache) Get(ctx context.Context, key string) (*CachedResponse, bool) {
+	entry, err := c.dbService.GetCachedResponse(ctx, key)
+	if err != nil || entry == nil {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (c *postgresCache) Set(ctx context.Context, key string, entry *CachedResponse) error {
+	return c.dbService.UpsertCachedResponse(ctx, key, entry)
+}
+
+func (c *postgresCache) Purge(ctx context.Context, service string) error {
+	return c.dbService.PurgeCachedResponses(ctx, service)
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts      = 3
+	defaultRetryInitialBackoffMs = 500
+	defaultRetryMaxBackoffMs     = 8000
+)
+
+// RetryPolicy controls how often a completion call is retried against the same provider
+type RetryPolicy struct {
+	MaxAttempts      int `json:"max_attempts,omitempty"`       // Total attempts per provider, including the first
+	InitialBackoffMs int `json:"initial_backoff_ms,omitempty"` // Backoff before the first retry
+	MaxBackoffMs     int `json:"max_backoff_ms,omitempty"`     // Upper bound for any single wait, including Retry-After
+}
+
+// withDefaults returns a copy of the policy with unset fields filled in
+func (p *RetryPolicy) withDefaults() RetryPolicy {
+	policy := RetryPolicy{
+		MaxAttempts:      defaultRetryMaxAttempts,
+		InitialBackoffMs: defaultRetryInitialBackoffMs,
+		MaxBackoffMs:     defaultRetryMaxBackoffMs,
+	}
+	if p == nil {
+		return policy
+	}
+	if p.MaxAttempts > 0 {
+		policy.MaxAttempts = p.MaxAttempts
+	}
+	if p.InitialBackoffMs > 0 {
+		policy.InitialBackoffMs = p.InitialBackoffMs
+	}
+	if p.MaxBackoffMs > 0 {
+		policy.MaxBackoffMs = p.MaxBackoffMs
+	}
+	return policy
+}
+
+// maxBackoff returns the longest single wait the policy allows
+func (p RetryPolicy) maxBackoff() time.Duration {
+	return time.Duration(p.MaxBackoffMs) * time.Millisecond
+}
+
+// backoff returns the jittered exponential wait before the given retry (1-based)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	wait := time.Duration(p.InitialBackoffMs) * time.Millisecond
+	for i := 1; i < retry && wait < p.maxBackoff(); i++ {
+		wait *= 2
+	}
+	if wait > p.maxBackoff() {
+		wait = p.maxBackoff()
+	}
+	// Equal jitter: keep half of the wait and randomize the rest
+	half := wait / 2
+	return half + time.Duration(rand.Int64N(int64(half)+1))
+}
+
+// retryDelay returns the wait requested by the provider for a failed call, if any
+func retryDelay(err error) time.Duration {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.RetryAfter
+	}
+	return 0
+}
+
+// parseRetryAfter reads the Retry-After and x-ratelimit-reset headers of a provider response
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			return date.Sub(now)
+		}
+	}
+
+	for _, name := range []string{"x-ratelimit-reset", "x-ratelimit-reset-requests", "x-ratelimit-reset-tokens"} {
+		if delay := parseRateLimitReset(header.Get(name), now); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// parseRateLimitReset understands durations ("1m30s", "7.5s"), seconds and unix timestamps
+func parseRateLimitReset(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if delay, err := time.ParseDuration(value); err == nil {
+		return delay
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	// Large values are absolute unix timestamps rather than relative seconds
+	if seconds > 1e9 {
+		return time.Unix(int64(seconds), 0).Sub(now)
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
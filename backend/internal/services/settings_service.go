@@ -1,24 +1,131 @@
 package services
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/Grodondo/AI-Coding-Tutor-IDE-Plugin/backend/internal/utils"
 )
 
+// ProviderEntry identifies a provider, model and credentials used to serve a request
+type ProviderEntry struct {
+	AIProvider      string        `json:"ai_provider"`
+	AIModel         string        `json:"ai_model"`
+	EncryptedAPIKey string        `json:"encrypted_api_key"`
+	APIKey          string        `json:"-"`                     // Decrypted, never stored or returned
+	APIURL          string        `json:"api_url,omitempty"`     // API endpoint URL for the provider
+	Endpoint        string        `json:"endpoint,omitempty"`    // Resource name substituted for {endpoint} in the API URL
+	Deployment      string        `json:"deployment,omitempty"`  // Deployment name substituted for {deployment} in the API URL
+	APIVersion      string        `json:"api_version,omitempty"` // API version substituted for {api_version} in the API URL
+	Mock            *MockSettings `json:"mock,omitempty"`        // Scripted behaviour when the provider is "mock"
+}
+
 // Settings holds the AI configuration
 type AiSettings struct {
-	AIProvider      string            `json:"ai_provider"`
-	AIModel         string            `json:"ai_model"`
-	EncryptedAPIKey string            `json:"encrypted_api_key"`
-	APIKey          string            // Decrypted, not stored in DB
-	Temperature     *float64          `json:"temperature,omitempty"` // AI model temperature
-	Prompts         map[string]string `json:"prompts"`
-	APIURL          string            `json:"api_url,omitempty"` // API endpoint URL for the provider
+	ProviderEntry
+	Temperature    *float64                `json:"temperature,omitempty"` // AI model temperature
+	Prompts        Prompts                 `json:"prompts"`
+	Fallbacks      []ProviderEntry         `json:"fallbacks,omitempty"`       // Tried in order when the primary provider fails
+	Retry          *RetryPolicy            `json:"retry,omitempty"`           // Retries against the same provider before falling back
+	TimeoutSeconds int                     `json:"timeout_seconds,omitempty"` // Deadline for a whole AI call, including retries and fallbacks
+	Cache          *CacheSettings          `json:"cache,omitempty"`           // Opt-in cache for identical prompts
+	CircuitBreaker *CircuitBreakerSettings `json:"circuit_breaker,omitempty"` // Thresholds for short-circuiting failing providers
+}
+
+// Prompts holds the system prompt of each level, and per-language overrides of them. In JSON both share
+// one object: string values are level prompts, object values map a language to its own level prompts,
+// e.g. {"novice": "...", "go": {"novice": "..."}}.
+type Prompts struct {
+	Levels    map[string]string
+	Languages map[string]map[string]string
 }
 
+// UnmarshalJSON splits the prompts object into level prompts and language overrides. Language keys are
+// normalized, so aliases such as "py" apply to the language ID the requests resolve to.
+func (p *Prompts) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	p.Levels = make(map[string]string)
+	p.Languages = make(map[string]map[string]string)
+	for key, value := range raw {
+		var prompt string
+		if err := json.Unmarshal(value, &prompt); err == nil {
+			p.Levels[key] = prompt
+			continue
+		}
+		var overrides map[string]string
+		if err := json.Unmarshal(value, &overrides); err != nil {
+			return fmt.Errorf("prompt %q must be a string or an object of level prompts", key)
+		}
+		language, ok := utils.NormalizeLanguage(key)
+		if !ok {
+			return fmt.Errorf("prompt %q is not a language ID", key)
+		}
+		if _, exists := p.Languages[language]; exists {
+			return fmt.Errorf("prompts for language %q are given more than once", language)
+		}
+		p.Languages[language] = overrides
+	}
+	return nil
+}
+
+// MarshalJSON writes level prompts and language overrides back into one object
+func (p Prompts) MarshalJSON() ([]byte, error) {
+	merged := make(map[string]interface{}, len(p.Levels)+len(p.Languages))
+	for level, prompt := range p.Levels {
+		merged[level] = prompt
+	}
+	for language, overrides := range p.Languages {
+		merged[language] = overrides
+	}
+	return json.Marshal(merged)
+}
+
+// Prompt returns the system prompt for a level, preferring the override for the language.
+// It returns false when the level has no prompt.
+func (p *Prompts) Prompt(language, level string) (string, bool) {
+	if prompt, ok := p.Languages[language][level]; ok {
+		return prompt, true
+	}
+	prompt, ok := p.Levels[level]
+	return prompt, ok
+}
+
+// PromptVersion identifies a prompt by a short hash so answers can be compared across prompt edits
+func PromptVersion(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:6])
+}
+
+// defaultAITimeout bounds AI calls of services without a timeout_seconds setting
+const defaultAITimeout = 60 * time.Second
+
+// temperature returns the configured model temperature or the default of 0.7
+func (s *AiSettings) temperature() float64 {
+	if s.Temperature != nil {
+		return *s.Temperature
+	}
+	return 0.7
+}
+
+// Timeout returns the deadline applied to the service's AI calls
+func (s *AiSettings) Timeout() time.Duration {
+	if s.TimeoutSeconds > 0 {
+		return time.Duration(s.TimeoutSeconds) * time.Second
+	}
+	return defaultAITimeout
+}
+
+// defaultAzureAPIVersion is used when an Azure OpenAI service has no api_version configured
+const defaultAzureAPIVersion = "2024-02-01"
+
 // ProviderConfig holds the default configuration for AI providers
 type ProviderConfig struct {
 	Name        string `json:"name"`
@@ -46,7 +153,7 @@ func GetSupportedProviders() []ProviderConfig {
 		},
 		{
 			Name:        "azure-openai",
-			DefaultURL:  "https://{endpoint}.openai.azure.com/openai/deployments/{deployment}/chat/completions?api-version=2023-12-01-preview",
+			DefaultURL:  "https://{endpoint}.openai.azure.com/openai/deployments/{deployment}/chat/completions?api-version={api_version}",
 			Description: "Azure OpenAI API",
 		},
 		{
@@ -59,6 +166,16 @@ func GetSupportedProviders() []ProviderConfig {
 			DefaultURL:  "https://api-inference.huggingface.co/models/{model}",
 			Description: "Hugging Face Inference API",
 		},
+		{
+			Name:        "local",
+			DefaultURL:  "",
+			Description: "Local OpenAI-compatible server such as Ollama or llama.cpp (API key optional)",
+		},
+		{
+			Name:        "mock",
+			DefaultURL:  "mock://local",
+			Description: "Built-in deterministic mock for offline development and tests (no API key)",
+		},
 		{
 			Name:        "custom",
 			DefaultURL:  "",
@@ -109,14 +226,35 @@ func (ss *SettingsService) LoadAiSettings() error {
 			return err
 		}
 
-		// Decrypt the API key
-		apiKey, err := utils.Decrypt(settings.EncryptedAPIKey, encryptionKey)
-		if err != nil {
+		// Decrypt the API keys (local providers may not have one)
+		if err := decryptProviderEntry(&settings.ProviderEntry, encryptionKey); err != nil {
 			return err
 		}
-		settings.APIKey = apiKey
+		for i := range settings.Fallbacks {
+			if err := decryptProviderEntry(&settings.Fallbacks[i], encryptionKey); err != nil {
+				return err
+			}
+		}
 		ss.settings[service] = &settings
 	}
+
+	// The reloaded entries get fresh mock call counters
+	if mock, ok := providerAdapters["mock"].(*MockAdapter); ok {
+		mock.Reset()
+	}
+	return nil
+}
+
+// decryptProviderEntry fills in the decrypted API key of a provider entry
+func decryptProviderEntry(entry *ProviderEntry, encryptionKey string) error {
+	if entry.EncryptedAPIKey == "" {
+		return nil
+	}
+	apiKey, err := utils.Decrypt(entry.EncryptedAPIKey, encryptionKey)
+	if err != nil {
+		return err
+	}
+	entry.APIKey = apiKey
 	return nil
 }
 
@@ -148,18 +286,22 @@ func (ss *SettingsService) GetAiSettings(service string) (*AiSettings, error) {
 }
 
 // GetProviderAPIURL returns the API URL for a given provider
-// If the settings don't contain a custom URL, it returns the default URL for the provider
-func (ss *SettingsService) GetProviderAPIURL(provider string, settings *AiSettings) string {
+// If the settings don't contain a custom URL, it returns the default URL for the provider.
+// Placeholders such as {model} are filled in from the settings.
+func (ss *SettingsService) GetProviderAPIURL(provider string, settings *ProviderEntry) string {
 	// If settings contain a custom API URL, use it
 	if settings != nil && settings.APIURL != "" {
-		return settings.APIURL
+		if provider == "local" {
+			return LocalChatURL(settings.APIURL)
+		}
+		return expandURLPlaceholders(settings.APIURL, settings)
 	}
 
 	// Otherwise, return the default URL for the provider
 	supportedProviders := GetSupportedProviders()
 	for _, providerConfig := range supportedProviders {
 		if providerConfig.Name == provider {
-			return providerConfig.DefaultURL
+			return expandURLPlaceholders(providerConfig.DefaultURL, settings)
 		}
 	}
 
@@ -167,6 +309,42 @@ func (ss *SettingsService) GetProviderAPIURL(provider string, settings *AiSettin
 	return ""
 }
 
+// expandURLPlaceholders substitutes {model}, {endpoint}, {deployment} and {api_version} with the values from the settings
+func expandURLPlaceholders(apiURL string, settings *ProviderEntry) string {
+	if settings == nil {
+		return apiURL
+	}
+	apiVersion := settings.APIVersion
+	if apiVersion == "" {
+		apiVersion = defaultAzureAPIVersion
+	}
+	replacer := strings.NewReplacer(
+		"{model}", settings.AIModel,
+		"{endpoint}", settings.Endpoint,
+		"{deployment}", settings.Deployment,
+		"{api_version}", apiVersion,
+	)
+	return replacer.Replace(apiURL)
+}
+
+// LocalChatURL turns the base URL of a local OpenAI-compatible server into its chat completions URL.
+// Full chat completions URLs are returned unchanged.
+func LocalChatURL(baseURL string) string {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if strings.HasSuffix(baseURL, "/chat/completions") {
+		return baseURL
+	}
+	if strings.HasSuffix(baseURL, "/v1") {
+		return baseURL + "/chat/completions"
+	}
+	return baseURL + "/v1/chat/completions"
+}
+
+// LocalModelsURL returns the /v1/models URL of a local OpenAI-compatible server
+func LocalModelsURL(baseURL string) string {
+	return strings.TrimSuffix(LocalChatURL(baseURL), "/chat/completions") + "/models"
+}
+
 // GetProviderConfig returns the configuration for a specific provider
 func GetProviderConfig(providerName string) *ProviderConfig {
 	supportedProviders := GetSupportedProviders()
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPromptsNormalizeLanguageKeys(t *testing.T) {
+	var prompts Prompts
+	err := json.Unmarshal([]byte(`{"novice": "Explain simply.", "py": {"novice": "Explain Python simply."}, "JS": {"expert": "Be terse."}}`), &prompts)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	tests := []struct {
+		language, level, want string
+	}{
+		{"python", "novice", "Explain Python simply."},
+		{"javascript", "expert", "Be terse."},
+		{"go", "novice", "Explain simply."},
+	}
+	for _, tt := range tests {
+		if got, ok := prompts.Prompt(tt.language, tt.level); !ok || got != tt.want {
+			t.Errorf("Prompt(%q, %q) = %q, %v, want %q", tt.language, tt.level, got, ok, tt.want)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"py": {"novice": "a"}, "python": {"novice": "b"}}`), &prompts); err == nil {
+		t.Errorf("Unmarshal accepted two override objects for the same language")
+	}
+}
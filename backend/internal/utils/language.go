@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// languageNames maps the supported language IDs, which follow VS Code's languageId values, to display names
+var languageNames = map[string]string{
+	"c":           "C",
+	"cpp":         "C++",
+	"csharp":      "C#",
+	"css":         "CSS",
+	"go":          "Go",
+	"html":        "HTML",
+	"java":        "Java",
+	"javascript":  "JavaScript",
+	"kotlin":      "Kotlin",
+	"php":         "PHP",
+	"python":      "Python",
+	"ruby":        "Ruby",
+	"rust":        "Rust",
+	"shellscript": "Shell",
+	"sql":         "SQL",
+	"swift":       "Swift",
+	"typescript":  "TypeScript",
+}
+
+// languageAliases maps common alternative names to language IDs
+var languageAliases = map[string]string{
+	"golang":          "go",
+	"py":              "python",
+	"python3":         "python",
+	"js":              "javascript",
+	"javascriptreact": "javascript",
+	"node":            "javascript",
+	"ts":              "typescript",
+	"typescriptreact": "typescript",
+	"c++":             "cpp",
+	"c#":              "csharp",
+	"cs":              "csharp",
+	"kt":              "kotlin",
+	"rb":              "ruby",
+	"rs":              "rust",
+	"sh":              "shellscript",
+	"bash":            "shellscript",
+	"shell":           "shellscript",
+	"zsh":             "shellscript",
+}
+
+// languageExtensions maps file extensions to language IDs
+var languageExtensions = map[string]string{
+	".c": "c", ".h": "c",
+	".cc": "cpp", ".cpp": "cpp", ".cxx": "cpp", ".hpp": "cpp",
+	".cs":  "csharp",
+	".css": "css",
+	".go":  "go",
+	".htm": "html", ".html": "html",
+	".java": "java",
+	".cjs":  "javascript", ".js": "javascript", ".jsx": "javascript", ".mjs": "javascript",
+	".kt": "kotlin", ".kts": "kotlin",
+	".php":  "php",
+	".py":   "python",
+	".rb":   "ruby",
+	".rs":   "rust",
+	".bash": "shellscript", ".sh": "shellscript", ".zsh": "shellscript",
+	".sql":   "sql",
+	".swift": "swift",
+	".ts":    "typescript", ".tsx": "typescript",
+}
+
+// languagePatterns holds telltale constructs per language; the language matching most of them wins
+var languagePatterns = []struct {
+	language string
+	patterns []*regexp.Regexp
+}{
+	{"go", compilePatterns(`(?m)^package \w+\s*$`, `(?m)^func (\(\w+ \*?\w+\) )?\w+\(`, `\w+ := `, `\bfmt\.\w+\(`)},
+	{"python", compilePatterns(`(?m)^\s*def \w+\(.*\)\s*(->.*)?:\s*$`, `(?m)^\s*(import \w+|from [\w.]+ import )`, `(?m)^\s*(elif|except)\b.*:\s*$`, `\bself\.\w+`, `(?m)^\s*print\(`)},
+	{"typescript", compilePatterns(`\b(let|const|var) \w+: \w+`, `(?m)^\s*(export )?interface \w+`, `\): (string|number|boolean|void|Promise<)`, `(?m)^\s*(export )?type \w+ = `)},
+	{"javascript", compilePatterns(`\b(const|let) \w+ = `, `\bfunction \w*\(`, `\bconsole\.log\(`, `=> \{`, `\brequire\(['"]`)},
+	{"java", compilePatterns(`\bpublic (static )?(final )?(class|void|int|String)\b`, `\bSystem\.out\.print`, `(?m)^import java\.`, `\bString\[\] args\b`)},
+	{"csharp", compilePatterns(`(?m)^using System`, `\bConsole\.Write`, `(?m)^\s*namespace [\w.]+`, `\bstring\[\] args\b`)},
+	{"cpp", compilePatterns(`#include <(iostream|vector|string|map|memory)>`, `\bstd::`, `\bcout <<`, `(?m)^\s*using namespace std;`)},
+	{"c", compilePatterns(`#include <\w+\.h>`, `\bprintf\(`, `\bmalloc\(`, `\bint main\(`)},
+	{"rust", compilePatterns(`(?m)^\s*(pub )?fn \w+`, `\blet mut \w+`, `\bprintln!\(`, `(?m)^\s*(impl|use) [\w:<>]+`)},
+	{"kotlin", compilePatterns(`(?m)^\s*fun \w+\(`, `\bval \w+`, `\bprintln\(`)},
+	{"swift", compilePatterns(`(?m)^\s*func \w+\(.*\) ->`, `(?m)^import (Foundation|UIKit|SwiftUI)`, `\bguard let\b`)},
+	{"ruby", compilePatterns(`(?m)^\s*def \w+[?!]?\s*$`, `(?m)^\s*end\s*$`, `\bputs\b`, `\.each do \|`)},
+	{"php", compilePatterns(`<\?php`, `\$\w+ = `, `\becho\b`)},
+	{"sql", compilePatterns(`(?i)\bselect\b[\s\S]+\bfrom\b`, `(?i)\b(insert into|create table|update \w+ set)\b`)},
+	{"html", compilePatterns(`(?i)<!doctype html`, `(?i)<(html|head|body|div|span)[\s>]`)},
+	{"shellscript", compilePatterns(`(?m)^\s*echo `, `\$\{?\w+\}?`, `(?m)^\s*(if|fi|then|done)\b`)},
+}
+
+// minDetectionScore is the number of telltale constructs code must show before its language is guessed
+const minDetectionScore = 2
+
+// safeLanguageID restricts caller-supplied language IDs to identifier characters
+var safeLanguageID = regexp.MustCompile(`^[a-z0-9+#._-]{1,32}$`)
+
+// compilePatterns compiles regular expressions for languagePatterns
+func compilePatterns(patterns ...string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		compiled[i] = regexp.MustCompile(pattern)
+	}
+	return compiled
+}
+
+// NormalizeLanguage lowercases a language name and resolves aliases such as "golang" or "py".
+// It returns false for names that are not plain identifiers.
+func NormalizeLanguage(language string) (string, bool) {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if alias, ok := languageAliases[language]; ok {
+		language = alias
+	}
+	return language, safeLanguageID.MatchString(language)
+}
+
+// LanguageName returns the display name of a language ID, or the ID itself for unknown languages
+func LanguageName(language string) string {
+	if name, ok := languageNames[language]; ok {
+		return name
+	}
+	return language
+}
+
+// DetectLanguage guesses the language of code from the file extension, a shebang line or, failing
+// those, the constructs the code uses. A guess from constructs needs at least minDetectionScore of
+// them and a clear lead over the next language. It returns an empty string when the language is unknown.
+func DetectLanguage(filename, code string) string {
+	if language, ok := languageExtensions[strings.ToLower(path.Ext(filename))]; ok {
+		return language
+	}
+
+	if firstLine, _, _ := strings.Cut(code, "\n"); strings.HasPrefix(firstLine, "#!") {
+		fields := strings.Fields(strings.TrimPrefix(firstLine, "#!"))
+		if len(fields) > 0 {
+			interpreter := path.Base(fields[len(fields)-1])
+			if language, ok := NormalizeLanguage(strings.TrimRight(interpreter, "0123456789.")); ok {
+				if _, known := languageNames[language]; known {
+					return language
+				}
+			}
+		}
+	}
+
+	best, bestScore, runnerUpScore := "", 0, 0
+	for _, candidate := range languagePatterns {
+		score := 0
+		for _, pattern := range candidate.patterns {
+			if pattern.MatchString(code) {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore, runnerUpScore = candidate.language, score, bestScore
+		} else if score > runnerUpScore {
+			runnerUpScore = score
+		}
+	}
+	if bestScore < minDetectionScore || bestScore == runnerUpScore {
+		return ""
+	}
+	return best
+}
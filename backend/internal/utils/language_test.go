@@ -0,0 +1,28 @@
+package utils
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		code     string
+		want     string
+	}{
+		{"extension", "main.GO", "", "go"},
+		{"shebang", "", "#!/usr/bin/env python3\nprint(1)\n", "python"},
+		{"go constructs", "", "package main\n\nfunc main() {\n\tfmt.Println(1)\n}\n", "go"},
+		{"python constructs", "", "import os\n\ndef main():\n    print(os.getcwd())\n", "python"},
+		{"single construct is not enough", "", "const greeting = `Hello ${name}`;\n", ""},
+		{"dollar signs alone are not shell", "", "The price is $5 or ${price}.\n", ""},
+		{"tie between languages", "", "let total = 0;\nconsole.log(total)\necho $total\n", ""},
+		{"plain text", "", "Hello, world!\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectLanguage(tt.filename, tt.code); got != tt.want {
+				t.Errorf("DetectLanguage(%q, %q) = %q, want %q", tt.filename, tt.code, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,13 +1,99 @@
 CREATE EXTENSION IF NOT EXISTS pgcrypto;
 
+-- Users table for authentication
+CREATE TABLE users (
+    id SERIAL PRIMARY KEY,
+    first_name VARCHAR(255) NOT NULL,
+    last_name VARCHAR(255) NOT NULL,
+    email VARCHAR(255) UNIQUE NOT NULL,
+    username VARCHAR(255) UNIQUE NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    role VARCHAR(50) NOT NULL DEFAULT 'user',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_login TIMESTAMP WITH TIME ZONE,
+    api_token_hash CHAR(64) UNIQUE, -- SHA-256 of the user's personal API token, NULL when none was issued
+    api_token_created_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Conversations table to group queries into chat threads
+CREATE TABLE conversations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE, -- Owner, the only user who can see the thread
+    title VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Queries table to store user queries and AI responses aswell as feedback
 CREATE TABLE queries (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    conversation_id UUID REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE, -- NULL for anonymous queries
+    service VARCHAR(50) NOT NULL DEFAULT 'query', -- e.g., 'query', 'analyze'
     query TEXT NOT NULL,
     provider_name VARCHAR(50) NOT NULL,
+    model VARCHAR(255),
     level VARCHAR(10) NOT NULL CHECK (level IN ('novice', 'medium', 'expert')),
+    prompt_version VARCHAR(16) NOT NULL DEFAULT '', -- Hash of the level prompt that produced the answer
+    response TEXT NOT NULL,
+    feedback VARCHAR(10) CHECK (feedback IN ('positive', 'negative', 'neutral', NULL)), -- Latest overall vote, details in the feedback table
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    total_tokens INTEGER NOT NULL DEFAULT 0,
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    -- Full-text index over questions (weighted higher) and answers
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(query, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(response, '')), 'B')
+    ) STORED
+);
+
+CREATE INDEX idx_queries_search_vector ON queries USING GIN (search_vector);
+CREATE INDEX idx_queries_service_created_at ON queries (service, created_at);
+CREATE INDEX idx_queries_conversation_created_at ON queries (conversation_id, created_at);
+CREATE INDEX idx_queries_user_created_at ON queries (user_id, created_at);
+
+-- Individual suggestions returned by code analysis, so they can receive feedback
+CREATE TABLE suggestions (
+    id SERIAL PRIMARY KEY,
+    query_id UUID NOT NULL REFERENCES queries(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,     -- Index in the analyze response
+    line INTEGER NOT NULL,         -- Zero-based line the suggestion refers to
+    message TEXT NOT NULL,
+    details JSONB NOT NULL,        -- Suggestion as returned to the client
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (query_id, position)
+);
+
+-- Feedback on answers and on individual suggestions
+CREATE TABLE feedback (
+    id SERIAL PRIMARY KEY,
+    query_id UUID NOT NULL REFERENCES queries(id) ON DELETE CASCADE,
+    suggestion_id INTEGER REFERENCES suggestions(id) ON DELETE CASCADE, -- NULL for feedback on the whole answer
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,             -- NULL for anonymous feedback
+    vote VARCHAR(10) CHECK (vote IN ('positive', 'negative', 'neutral')),
+    rating SMALLINT CHECK (rating BETWEEN 1 AND 5),
+    comment TEXT,
+    reasons TEXT[] NOT NULL DEFAULT '{}', -- e.g. 'wrong', 'too_advanced', 'unclear'
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (vote IS NOT NULL OR rating IS NOT NULL OR comment IS NOT NULL)
+);
+
+-- Signed-in users have one feedback entry per answer or suggestion, which later submissions update
+CREATE UNIQUE INDEX idx_feedback_user_target ON feedback (query_id, COALESCE(suggestion_id, 0), user_id) WHERE user_id IS NOT NULL;
+CREATE INDEX idx_feedback_created_at ON feedback (created_at);
+
+-- Optional shared store for the AI response cache
+CREATE TABLE response_cache (
+    cache_key CHAR(64) PRIMARY KEY,  -- SHA-256 of service, provider, model, temperature and prompt
+    service VARCHAR(50) NOT NULL,
+    provider_name VARCHAR(50) NOT NULL,
+    model VARCHAR(255),
     response TEXT NOT NULL,
-    feedback VARCHAR(10) CHECK (feedback IN ('positive', 'negative', NULL)),
+    expires_at TIMESTAMP NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -21,20 +107,6 @@ CREATE TABLE settings (
     UNIQUE(service)                -- One config per service
 );
 
--- Users table for authentication
-CREATE TABLE users (
-    id SERIAL PRIMARY KEY,
-    first_name VARCHAR(255) NOT NULL,
-    last_name VARCHAR(255) NOT NULL,
-    email VARCHAR(255) UNIQUE NOT NULL,
-    username VARCHAR(255) UNIQUE NOT NULL,
-    password_hash VARCHAR(255) NOT NULL,
-    role VARCHAR(50) NOT NULL DEFAULT 'user',
-    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    last_login TIMESTAMP WITH TIME ZONE
-);
-
 -- Insert initial settings
 INSERT INTO settings (service, config, is_default) VALUES
 ('query', '{